@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+
+	"github.com/totvs/addon-framework-basic/pkg/addon"
+	"github.com/totvs/addon-framework-basic/pkg/hub"
+)
+
+// newFindImageCommand creates the subcommand that lists the managed clusters
+// running an image, from the image reports of their agents.
+func newFindImageCommand() *cobra.Command {
+	var kubeconfig, image string
+
+	cmd := &cobra.Command{
+		Use:   "find-image",
+		Short: "List the managed clusters running an image",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+			loadingRules.ExplicitPath = kubeconfig
+			restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil).ClientConfig()
+			if err != nil {
+				return err
+			}
+			kubeClient, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+			addonClient, err := addonclient.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+
+			search, err := hub.FindImage(context.Background(), kubeClient, addonClient, addon.AddonName, image)
+			if err != nil {
+				return err
+			}
+			// A truncated report may leave the image out, so not found there isn't conclusive
+			if len(search.IncompleteClusters) > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: the image reports of %s are truncated, the result is incomplete for them\n",
+					strings.Join(search.IncompleteClusters, ", "))
+			}
+			if len(search.Matches) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No cluster runs %s\n", image)
+				return nil
+			}
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "CLUSTER\tIMAGE\tDIGEST\tWORKLOADS")
+			for _, match := range search.Matches {
+				workloads := strings.Join(match.Workloads, ",")
+				if more := match.TotalWorkloads - len(match.Workloads); more > 0 {
+					workloads += fmt.Sprintf(" (+%d)", more)
+				}
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", match.ClusterName, match.Image, match.Digest, workloads)
+			}
+			return writer.Flush()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&kubeconfig, "kubeconfig", kubeconfig,
+		"Location of kubeconfig file to connect to hub cluster.")
+	flags.StringVar(&image, "image", image,
+		"Image to search for: a digest (sha256:... or repo@sha256:...) or a reference, with or without tag.")
+	return cmd
+}
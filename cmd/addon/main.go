@@ -10,7 +10,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
-	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	utilflag "k8s.io/component-base/cli/flag"
 	"k8s.io/klog/v2"
@@ -18,10 +19,14 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
 	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/addon-framework/pkg/version"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	clusterclient "open-cluster-management.io/api/client/cluster/clientset/versioned"
 
 	"github.com/totvs/addon-framework-basic/pkg/addon"
 	"github.com/totvs/addon-framework-basic/pkg/agent"
+	"github.com/totvs/addon-framework-basic/pkg/hub"
 )
 
 // esta função serve para 
@@ -58,21 +63,49 @@ func newCommand() *cobra.Command {
 
 	cmd.AddCommand(newControllerCommand())
 	cmd.AddCommand(agent.NewAgentCommand(addon.AddonName))
+	cmd.AddCommand(agent.NewCleanupCommand(addon.AddonName))
+	cmd.AddCommand(newRotateIdentityCommand())
+	cmd.AddCommand(newFindImageCommand())
 
 	return cmd
 }
 
 func newControllerCommand() *cobra.Command {
+	o := newControllerOptions()
 	cmd := cmdfactory.
-		NewControllerCommandConfig("basic-addon-controller", version.Get(), runController).
+		NewControllerCommandConfig("basic-addon-controller", version.Get(), o.runController).
 		NewCommand()
 	cmd.Use = "controller"
 	cmd.Short = "Start the addon controller"
 
+	o.addFlags(cmd)
 	return cmd
 }
 
-func runController(ctx context.Context, kubeConfig *rest.Config) error {
+// controllerOptions defines the flags for the controller.
+type controllerOptions struct {
+	// CSRRequiredClusterLabels must be set on a ManagedCluster before its agent CSRs are approved.
+	CSRRequiredClusterLabels map[string]string
+	// CommandTTL is how long completed AddonCommands are kept.
+	CommandTTL time.Duration
+}
+
+func newControllerOptions() *controllerOptions {
+	return &controllerOptions{
+		CSRRequiredClusterLabels: map[string]string{},
+		CommandTTL:               hub.DefaultCommandTTL,
+	}
+}
+
+func (o *controllerOptions) addFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringToStringVar(&o.CSRRequiredClusterLabels, "csr-required-cluster-labels", o.CSRRequiredClusterLabels,
+		"Labels (key=value) a ManagedCluster must have before agent CSRs from it are approved.")
+	flags.DurationVar(&o.CommandTTL, "command-ttl", o.CommandTTL,
+		"How long AddonCommands are kept after they complete.")
+}
+
+func (o *controllerOptions) runController(ctx context.Context, kubeConfig *rest.Config) error {
 	klog.Info("Starting basic-addon controller")
 
 	mgr, err := addonmanager.New(kubeConfig)
@@ -80,14 +113,42 @@ func runController(ctx context.Context, kubeConfig *rest.Config) error {
 		return err
 	}
 
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return err
+	}
+	addonClient, err := addonclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return err
+	}
+	clusterClient, err := clusterclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return err
+	}
+	recorder := hub.NewEventRecorder(kubeClient, "basic-addon-controller")
+
 	registrationOption := addon.NewRegistrationOption(
 		kubeConfig,
 		addon.AddonName,
-		utilrand.String(5),
+		hub.CSRApprovalPolicy{
+			RequiredClusterLabels: o.CSRRequiredClusterLabels,
+			Recorder:              recorder,
+		},
 	)
 
 	agentAddon, err := addonfactory.NewAgentAddonFactory(addon.AddonName, addon.FS, "manifests/templates").
-		WithGetValuesFuncs(addon.GetDefaultValues).
+		WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
+		WithGetValuesFuncs(
+			addon.GetDefaultValues,
+			addonfactory.GetAddOnDeploymentConfigValues(
+				utils.NewAddOnDeploymentConfigGetter(addonClient),
+				addonfactory.ToAddOnCustomizedVariableValues,
+			),
+		).
 		WithAgentRegistrationOption(registrationOption).
 		WithAgentHealthProber(addon.AgentHealthProber()).
 		BuildTemplateAgentAddon()
@@ -106,6 +167,13 @@ func runController(ctx context.Context, kubeConfig *rest.Config) error {
 		return err
 	}
 
+	// Periodically revert manual edits to the agent RBAC on the hub
+	go hub.NewRBACReconciler(kubeClient, addonClient, clusterClient, recorder, addon.AddonName, hub.RBACResyncInterval).Run(ctx)
+	// Delete the log bundles uploaded by the agents once they expire
+	go hub.NewLogBundleReaper(kubeClient, hub.LogBundleResyncInterval).Run(ctx)
+	// Delete the commands the agents completed once they expire
+	go hub.NewCommandReaper(dynamicClient, o.CommandTTL, hub.CommandResyncInterval).Run(ctx)
+
 	<-ctx.Done()
 	return nil
 }
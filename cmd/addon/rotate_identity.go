@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	clusterclient "open-cluster-management.io/api/client/cluster/clientset/versioned"
+
+	"github.com/totvs/addon-framework-basic/pkg/addon"
+	"github.com/totvs/addon-framework-basic/pkg/hub"
+)
+
+// newRotateIdentityCommand creates the subcommand that rotates the agent
+// identity of a managed cluster, forcing the agent to register again.
+func newRotateIdentityCommand() *cobra.Command {
+	var kubeconfig, clusterName string
+
+	cmd := &cobra.Command{
+		Use:   "rotate-identity",
+		Short: "Rotate the agent identity of a managed cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(clusterName) == 0 {
+				return fmt.Errorf("--cluster is required")
+			}
+
+			loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+			loadingRules.ExplicitPath = kubeconfig
+			restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil).ClientConfig()
+			if err != nil {
+				return err
+			}
+			clusterClient, err := clusterclient.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+			addonClient, err := addonclient.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+
+			agentName, err := hub.RotateAgentIdentity(context.Background(), clusterClient, addonClient, clusterName, addon.AddonName)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Agent identity of cluster %s rotated, new agent name: %s\n", clusterName, agentName)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&kubeconfig, "kubeconfig", kubeconfig,
+		"Location of kubeconfig file to connect to hub cluster.")
+	flags.StringVar(&clusterName, "cluster", clusterName,
+		"Name of the managed cluster whose agent identity is rotated.")
+	return cmd
+}
@@ -8,7 +8,6 @@ import (
 	"k8s.io/client-go/rest"
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/agent"
-	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	workapiv1 "open-cluster-management.io/api/work/v1"
@@ -20,6 +19,21 @@ const (
 	AddonName                    = "basic-addon"
 	DefaultBasicAddonImage       = "basic-addon:latest"
 	InstallationNamespace        = "open-cluster-management-agent-addon"
+
+	// Defaults for spreading agent syncs and hub writes across the fleet.
+	// Override them with customizedVariables of the same name in an AddOnDeploymentConfig.
+	DefaultSyncInitialDelay = "30s"
+	DefaultSyncJitter       = "0.2"
+	DefaultHubWriteQPS      = "1"
+	DefaultHubWriteBurst    = "5"
+
+	// DefaultSyncInterval is the interval of all agent strategies. Each strategy
+	// interval (PodReportInterval, AddonStatusInterval, PlacementScoreInterval,
+	// ClusterClaimInterval, EventsReportInterval, NodeReportInterval,
+	// WorkloadReportInterval, ImageReportInterval, StorageReportInterval,
+	// QuotaReportInterval) is unset by default and falls back to it.
+	// CommandInterval is unset too, but the agent polls for commands every 10s.
+	DefaultSyncInterval = "60s"
 )
 
 //go:embed manifests
@@ -28,10 +42,13 @@ var FS embed.FS
 
 // NewRegistrationOption returns the registration option for the addon agent.
 // This enables the agent to get a kubeconfig to communicate with the hub.
-func NewRegistrationOption(kubeConfig *rest.Config, addonName, agentName string) *agent.RegistrationOption {
+// The agent name is derived per cluster (see hub.AgentName), and agent CSRs
+// are only approved when they satisfy csrPolicy.
+func NewRegistrationOption(kubeConfig *rest.Config, addonName string,
+	csrPolicy hub.CSRApprovalPolicy) *agent.RegistrationOption {
 	return &agent.RegistrationOption{
-		CSRConfigurations: agent.KubeClientSignerConfigurations(addonName, agentName),
-		CSRApproveCheck:   utils.DefaultCSRApprover(agentName),
+		CSRConfigurations: hub.AgentSignerConfigurations(addonName),
+		CSRApproveCheck:   hub.CSRApprover(csrPolicy),
 		PermissionConfig:  hub.AddonRBAC(kubeConfig),
 	}
 }
@@ -50,10 +67,67 @@ func GetDefaultValues(cluster *clusterv1.ManagedCluster,
 		KubeConfigSecret string
 		ClusterName      string
 		Image            string
+		SyncInitialDelay string
+		SyncJitter       string
+		HubWriteQPS      string
+		HubWriteBurst    string
+
+		SyncInterval           string
+		PodReportInterval      string
+		AddonStatusInterval    string
+		PlacementScoreInterval string
+		ClusterClaimInterval   string
+		CommandInterval        string
+		EventsReportInterval   string
+		NodeReportInterval     string
+		WorkloadReportInterval string
+		ImageReportInterval    string
+		StorageReportInterval  string
+		QuotaReportInterval    string
+
+		// PlacementScorers is a JSON list of agent.ScorerConfig configuring how
+		// placement scores are computed. Unset, the agent uses its default scorers.
+		PlacementScorers string
+
+		// PlacementScoreSmoothing and PlacementScoreHysteresis damp placement
+		// score swings. Unset, scores are published as computed.
+		PlacementScoreSmoothing  string
+		PlacementScoreHysteresis string
+
+		// ClusterClaims is a comma separated list of the cluster claims to
+		// publish and ClusterClaimPrefix the prefix of their names. Unset, the
+		// agent publishes the Kubernetes version with the basic-addon. prefix.
+		ClusterClaims      string
+		ClusterClaimPrefix string
+
+		// RestartThreshold and RestartWindow set how many restarts of a
+		// container within the window flag its workload in the WorkloadsHealthy
+		// condition. Unset, 5 restarts in 1h.
+		RestartThreshold string
+		RestartWindow    string
+
+		// QuotaThreshold is the used/hard ratio at or above which a
+		// ResourceQuota is flagged. Unset, 0.9.
+		QuotaThreshold string
+
+		// EventReasons is a comma separated list of the reasons of the Warning
+		// events to report. Unset, the agent reports FailedScheduling, BackOff,
+		// FailedMount and OOMKilling.
+		EventReasons string
+
+		// CommandNamespaces is a comma separated list of the namespaces
+		// AddonCommands may read. Unset, commands can't read any namespace.
+		CommandNamespaces string
 	}{
 		KubeConfigSecret: fmt.Sprintf("%s-hub-kubeconfig", addon.Name),
 		ClusterName:      cluster.Name,
 		Image:            image,
+		SyncInitialDelay: DefaultSyncInitialDelay,
+		SyncJitter:       DefaultSyncJitter,
+		HubWriteQPS:      DefaultHubWriteQPS,
+		HubWriteBurst:    DefaultHubWriteBurst,
+
+		SyncInterval: DefaultSyncInterval,
 	}
 
 	return addonfactory.StructToValues(manifestConfig), nil
@@ -2,9 +2,11 @@ package addon
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,6 +16,9 @@ import (
 
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+	"github.com/totvs/addon-framework-basic/pkg/hub"
 )
 
 func TestGetDefaultValues(t *testing.T) {
@@ -32,6 +37,11 @@ func TestGetDefaultValues(t *testing.T) {
 				"KubeConfigSecret": "basic-addon-hub-kubeconfig",
 				"ClusterName":      "cluster1",
 				"Image":            DefaultBasicAddonImage,
+				"SyncInitialDelay": DefaultSyncInitialDelay,
+				"SyncJitter":       DefaultSyncJitter,
+				"HubWriteQPS":      DefaultHubWriteQPS,
+				"HubWriteBurst":    DefaultHubWriteBurst,
+				"SyncInterval":     DefaultSyncInterval,
 			},
 		},
 		{
@@ -108,6 +118,7 @@ func TestManifestAddonAgent(t *testing.T) {
 		name             string
 		cluster          *clusterv1.ManagedCluster
 		addon            *addonapiv1alpha1.ManagedClusterAddOn
+		values           addonfactory.Values
 		verifyDeployment func(t *testing.T, objs []runtime.Object)
 	}{
 		{
@@ -115,8 +126,8 @@ func TestManifestAddonAgent(t *testing.T) {
 			cluster: addontesting.NewManagedCluster("cluster1"),
 			addon:   addontesting.NewAddon("basic-addon", "cluster1"),
 			verifyDeployment: func(t *testing.T, objs []runtime.Object) {
-				if len(objs) != 3 {
-					t.Fatalf("expected 3 manifests (deployment, sa, clusterrolebinding), got %d", len(objs))
+				if len(objs) != 4 {
+					t.Fatalf("expected 4 manifests (deployment, sa, clusterrolebinding, cleanup job), got %d", len(objs))
 				}
 
 				deployment := findDeployment(objs)
@@ -132,6 +143,24 @@ func TestManifestAddonAgent(t *testing.T) {
 					t.Errorf("deployment namespace = %s, want %s", deployment.Namespace, addonfactory.AddonDefaultInstallNamespace)
 				}
 
+				args := deployment.Spec.Template.Spec.Containers[0].Args
+				for _, want := range []string{
+					"--initial-sync-delay=" + DefaultSyncInitialDelay,
+					"--sync-jitter=" + DefaultSyncJitter,
+					"--hub-write-qps=" + DefaultHubWriteQPS,
+					"--hub-write-burst=" + DefaultHubWriteBurst,
+					"--sync-interval=" + DefaultSyncInterval,
+				} {
+					if !containsString(args, want) {
+						t.Errorf("agent args %v don't contain %s", args, want)
+					}
+				}
+				for _, arg := range args {
+					if strings.HasPrefix(arg, "--placement-score-interval") {
+						t.Errorf("unexpected %s when no strategy interval is configured", arg)
+					}
+				}
+
 				sa := findServiceAccount(objs)
 				if sa == nil {
 					t.Fatal("expected serviceaccount in manifests")
@@ -145,6 +174,126 @@ func TestManifestAddonAgent(t *testing.T) {
 				if crb == nil {
 					t.Fatal("expected clusterrolebinding in manifests")
 				}
+
+				var job *batchv1.Job
+				for _, obj := range objs {
+					if j, ok := obj.(*batchv1.Job); ok {
+						job = j
+					}
+				}
+				if job == nil {
+					t.Fatal("expected cleanup job in manifests")
+				}
+				if _, ok := job.Annotations[addonapiv1alpha1.AddonPreDeleteHookAnnotationKey]; !ok {
+					t.Errorf("cleanup job annotations = %v, want the pre-delete hook annotation", job.Annotations)
+				}
+				if job.Name != basicagent.CleanupJobName {
+					t.Errorf("cleanup job name = %s, want %s", job.Name, basicagent.CleanupJobName)
+				}
+			},
+		},
+		{
+			name:    "placement scorers from deployment config",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("basic-addon", "cluster1"),
+			values: addonfactory.Values{
+				"PlacementScorers": `[{"name":"cpu","metric":"freeCPUMillis","normalization":"log","max":64000}]`,
+			},
+			verifyDeployment: func(t *testing.T, objs []runtime.Object) {
+				var configMap *corev1.ConfigMap
+				for _, obj := range objs {
+					if cm, ok := obj.(*corev1.ConfigMap); ok {
+						configMap = cm
+					}
+				}
+				if configMap == nil {
+					t.Fatal("expected placement scorers configmap in manifests")
+				}
+				want := `[{"name":"cpu","metric":"freeCPUMillis","normalization":"log","max":64000}]`
+				if got := strings.TrimSpace(configMap.Data["scorers.json"]); got != want {
+					t.Errorf("scorers.json = %s, want %s", got, want)
+				}
+
+				deployment := findDeployment(objs)
+				if deployment == nil {
+					t.Fatal("expected deployment in manifests")
+				}
+				args := deployment.Spec.Template.Spec.Containers[0].Args
+				if !containsString(args, "--placement-scorers-file=/etc/basic-addon/scorers/scorers.json") {
+					t.Errorf("agent args %v don't contain --placement-scorers-file", args)
+				}
+				for _, arg := range args {
+					if strings.HasPrefix(arg, "--placement-score-smoothing") {
+						t.Errorf("unexpected %s when no smoothing is configured", arg)
+					}
+				}
+				if volumes := deployment.Spec.Template.Spec.Volumes; volumes[len(volumes)-1].ConfigMap == nil {
+					t.Errorf("expected placement scorers volume, got %v", volumes)
+				}
+			},
+		},
+		{
+			name:    "multiline placement scorers from deployment config",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("basic-addon", "cluster1"),
+			values: addonfactory.Values{
+				"PlacementScorers": "[\n  {\"name\": \"cpu\", \"metric\": \"freeCPUMillis\"},\n  {\"name\": \"pods\", \"metric\": \"podCount\"}\n]",
+			},
+			verifyDeployment: func(t *testing.T, objs []runtime.Object) {
+				want := "[\n  {\"name\": \"cpu\", \"metric\": \"freeCPUMillis\"},\n  {\"name\": \"pods\", \"metric\": \"podCount\"}\n]"
+				for _, obj := range objs {
+					if cm, ok := obj.(*corev1.ConfigMap); ok {
+						if got := cm.Data["scorers.json"]; got != want {
+							t.Errorf("scorers.json = %q, want %q", got, want)
+						}
+						return
+					}
+				}
+				t.Fatal("expected placement scorers configmap in manifests")
+			},
+		},
+		{
+			name:    "agent flags from deployment config",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("basic-addon", "cluster1"),
+			values: addonfactory.Values{
+				"PlacementScoreSmoothing":  "0.3",
+				"PlacementScoreHysteresis": "5",
+				"ClusterClaims":            "k8s-version,node-count,cni",
+				"ClusterClaimPrefix":       "fleet.",
+				"CommandInterval":          "30s",
+				"EventsReportInterval":     "5m",
+				"StorageReportInterval":    "10m",
+				"QuotaReportInterval":      "15m",
+				"QuotaThreshold":           "0.8",
+				"EventReasons":             "BackOff,Evicted",
+				"RestartThreshold":         "3",
+				"RestartWindow":            "30m",
+			},
+			verifyDeployment: func(t *testing.T, objs []runtime.Object) {
+				deployment := findDeployment(objs)
+				if deployment == nil {
+					t.Fatal("expected deployment in manifests")
+				}
+				args := deployment.Spec.Template.Spec.Containers[0].Args
+				for _, want := range []string{
+					"--placement-score-smoothing=0.3",
+					"--placement-score-hysteresis=5",
+					"--cluster-claims=k8s-version,node-count,cni",
+					"--cluster-claim-prefix=fleet.",
+					"--command-interval=30s",
+					"--events-report-interval=5m",
+					"--storage-report-interval=10m",
+					"--quota-report-interval=15m",
+					"--quota-threshold=0.8",
+					"--event-reasons=BackOff,Evicted",
+					"--restart-threshold=3",
+					"--restart-window=30m",
+				} {
+					if !containsString(args, want) {
+						t.Errorf("agent args %v don't contain %s", args, want)
+					}
+				}
 			},
 		},
 	}
@@ -152,8 +301,11 @@ func TestManifestAddonAgent(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			agentAddon, err := addonfactory.NewAgentAddonFactory(AddonName, FS, "manifests/templates").
-				WithGetValuesFuncs(GetDefaultValues).
-				WithAgentRegistrationOption(NewRegistrationOption(nil, AddonName, "test-agent")).
+				WithGetValuesFuncs(GetDefaultValues, func(*clusterv1.ManagedCluster,
+					*addonapiv1alpha1.ManagedClusterAddOn) (addonfactory.Values, error) {
+					return tt.values, nil
+				}).
+				WithAgentRegistrationOption(NewRegistrationOption(nil, AddonName, hub.CSRApprovalPolicy{})).
 				WithAgentHealthProber(AgentHealthProber()).
 				BuildTemplateAgentAddon()
 			if err != nil {
@@ -213,3 +365,12 @@ func findClusterRoleBinding(objs []runtime.Object) *rbacv1.ClusterRoleBinding {
 	}
 	return nil
 }
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
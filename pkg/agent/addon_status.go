@@ -2,11 +2,13 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -18,9 +20,11 @@ var addonGVR = schema.GroupVersionResource{
 	Resource: "managedclusteraddons",
 }
 
-// syncAddonStatus updates the ManagedClusterAddOn status with pod count condition.
+// syncAddonStatus updates the ManagedClusterAddOn status with pod count condition,
+// and the WorkloadsHealthy condition from the container restarts tracked by restarts.
 // This demonstrates how agents can report health/status back to hub via addon conditions.
-func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernetes.Interface, hubDynamicClient dynamic.Interface) error {
+func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernetes.Interface,
+	restarts *restartTracker, outbox *outbox) error {
 	klog.V(4).Info("Syncing addon status")
 
 	// Count pods in spoke
@@ -30,12 +34,6 @@ func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernet
 	}
 	podCount := len(podList.Items)
 
-	// Get current ManagedClusterAddOn
-	addon, err := hubDynamicClient.Resource(addonGVR).Namespace(o.SpokeClusterName).Get(ctx, o.AddonName, metav1.GetOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to get addon: %w", err)
-	}
-
 	// Determine condition based on pod count
 	conditionStatus := metav1.ConditionTrue
 	reason := "PodCountWithinLimit"
@@ -56,6 +54,37 @@ func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernet
 		"lastTransitionTime": now.Format("2006-01-02T15:04:05Z"),
 	}
 
+	payload, err := json.Marshal(newCondition)
+	if err != nil {
+		return err
+	}
+	if err := outbox.publish(ctx, strategyAddonStatus, "PodCountHealthy", payload); err != nil {
+		return err
+	}
+
+	// Crashing and restarting containers
+	anomalies := restarts.observe(podList.Items)
+	payload, err = json.Marshal(restarts.workloadsHealthyCondition(anomalies))
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyAddonStatus, WorkloadsHealthyConditionType, payload)
+}
+
+// publishAddonStatus sets the condition in the payload on the ManagedClusterAddOn status.
+func (o *AgentOptions) publishAddonStatus(ctx context.Context, hubDynamicClient dynamic.Interface, payload []byte) error {
+	// util/json keeps integers as int64, as unstructured objects expect
+	newCondition := map[string]interface{}{}
+	if err := utiljson.Unmarshal(payload, &newCondition); err != nil {
+		return fmt.Errorf("failed to decode addon condition: %w", err)
+	}
+
+	// Get current ManagedClusterAddOn
+	addon, err := hubDynamicClient.Resource(addonGVR).Namespace(o.SpokeClusterName).Get(ctx, o.AddonName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get addon: %w", err)
+	}
+
 	// Get or create status.conditions
 	status, found, _ := unstructured.NestedMap(addon.Object, "status")
 	if !found {
@@ -74,7 +103,7 @@ func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernet
 		if !ok {
 			continue
 		}
-		if cond["type"] == "PodCountHealthy" {
+		if cond["type"] == newCondition["type"] {
 			conditions[i] = newCondition
 			updated = true
 			break
@@ -94,6 +123,6 @@ func (o *AgentOptions) syncAddonStatus(ctx context.Context, spokeClient kubernet
 		return fmt.Errorf("failed to update addon status: %w", err)
 	}
 
-	klog.Infof("Updated addon status with PodCountHealthy condition: %s (%d pods)", reason, podCount)
+	klog.Infof("Updated addon status with %s condition: %s", newCondition["type"], newCondition["reason"])
 	return nil
 }
@@ -3,16 +3,25 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
 	"open-cluster-management.io/addon-framework/pkg/version"
@@ -20,16 +29,56 @@ import (
 
 const (
 	PodReportConfigMapName = "pod-report"
-	SyncInterval           = 60 * time.Second
+
+	// maxPodReportEntries keeps the pod report below the ConfigMap size limit.
+	maxPodReportEntries = 3000
+
+	// DefaultSyncInterval is how often strategies without their own interval run.
+	DefaultSyncInterval = 60 * time.Second
+
+	// Strategy names, used to key buffered hub writes and metrics.
+	strategyPodReport      = "pod-report"
+	strategyAddonStatus    = "addon-status"
+	strategyPlacementScore = "placement-score"
+	strategyClusterClaim   = "cluster-claim"
+	strategyCommands       = "commands"
+	strategyEventsReport   = "events-report"
+	strategyNodeReport     = "node-report"
+	strategyWorkloadReport = "workload-report"
+	strategyImageReport    = "image-report"
+	strategyStorageReport  = "storage-report"
+	strategyQuotaReport    = "quota-report"
+	// strategyLogBundles only buffers the log uploads of collect-logs commands
+	strategyLogBundles = "log-bundles"
+
+	// Defaults for spreading hub load across the fleet.
+	DefaultInitialSyncDelay = 30 * time.Second
+	DefaultSyncJitterFactor = 0.2
+	DefaultHubWriteQPS      = 1
+	DefaultHubWriteBurst    = 5
 )
 
+// ReportConfigMapNames returns the names of all report ConfigMaps the agent
+// writes in the cluster namespace on the hub.
+func ReportConfigMapNames() []string {
+	return []string{PodReportConfigMapName, EventsReportConfigMapName, NodeReportConfigMapName,
+		WorkloadReportConfigMapName, ImageReportConfigMapName, StorageReportConfigMapName,
+		QuotaReportConfigMapName}
+}
+
 // PodReport is the structure sent to the hub with pod information.
 // This structure is extensible - add more fields as needed.
 type PodReport struct {
 	ClusterName string    `json:"clusterName"`
 	Timestamp   time.Time `json:"timestamp"`
 	TotalPods   int       `json:"totalPods"`
-	Pods        []PodInfo `json:"pods"`
+	// PendingPods counts the pods waiting to be scheduled and
+	// SchedulingCauses how many of them are pending for each cause.
+	PendingPods      int            `json:"pendingPods,omitempty"`
+	SchedulingCauses map[string]int `json:"schedulingCauses,omitempty"`
+	Pods             []PodInfo      `json:"pods"`
+	// Truncated is set when pods were left out of the report.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // PodInfo contains information about a single pod.
@@ -39,6 +88,8 @@ type PodInfo struct {
 	Namespace string `json:"namespace"`
 	Status    string `json:"status"`
 	NodeName  string `json:"nodeName,omitempty"`
+	// Scheduling explains why a pending pod is not scheduled yet.
+	Scheduling *SchedulingInfo `json:"scheduling,omitempty"`
 }
 
 // NewAgentCommand creates the agent subcommand.
@@ -60,11 +111,94 @@ type AgentOptions struct {
 	SpokeClusterName  string
 	AddonName         string
 	AddonNamespace    string
+	OutboxDir         string
+	OutboxMaxEntries  int
+	InitialSyncDelay  time.Duration
+	SyncJitterFactor  float64
+	HubWriteQPS       float32
+	HubWriteBurst     int
+
+	StrategyFailureThreshold  int
+	StrategyOpenRetryInterval time.Duration
+
+	// SyncInterval is the default interval of all strategies. A non-zero
+	// per-strategy interval overrides it for that strategy.
+	SyncInterval           time.Duration
+	PodReportInterval      time.Duration
+	AddonStatusInterval    time.Duration
+	PlacementScoreInterval time.Duration
+	ClusterClaimInterval   time.Duration
+	CommandInterval        time.Duration
+	EventsReportInterval   time.Duration
+	NodeReportInterval     time.Duration
+	WorkloadReportInterval time.Duration
+	ImageReportInterval    time.Duration
+	StorageReportInterval  time.Duration
+	QuotaReportInterval    time.Duration
+
+	// PlacementScorersFile is a JSON list of ScorerConfig. The default scorers
+	// are used when it is empty.
+	PlacementScorersFile string
+
+	// PlacementScoreSmoothing is the EWMA weight of the newest placement score,
+	// in (0, 1]. PlacementScoreHysteresis is the minimum change of a smoothed
+	// score, in points, before it is published.
+	PlacementScoreSmoothing  float64
+	PlacementScoreHysteresis int64
+
+	// ClusterClaims are the claims of the catalog to publish, named without
+	// ClusterClaimPrefix.
+	ClusterClaims      []string
+	ClusterClaimPrefix string
+
+	// RestartThreshold is the number of restarts of a container within
+	// RestartWindow that sets WorkloadsHealthy to False.
+	RestartThreshold int32
+	RestartWindow    time.Duration
+
+	// QuotaThreshold is the used/hard ratio of a quota resource, in (0, 1],
+	// at or above which the quota is flagged.
+	QuotaThreshold float64
+
+	// EventReasons are the reasons of the Warning events in the events
+	// report. All Warning events are reported when it is empty.
+	EventReasons []string
+
+	// CommandNamespaces are the namespaces commands may read, e.g. the logs
+	// of pod-logs. The agent can read every namespace, so commands may read
+	// none when it is empty.
+	CommandNamespaces []string
 }
 
 // NewAgentOptions returns the flags with default values.
 func NewAgentOptions(addonName string) *AgentOptions {
-	return &AgentOptions{AddonName: addonName}
+	return &AgentOptions{
+		AddonName:        addonName,
+		OutboxMaxEntries: DefaultOutboxMaxEntries,
+		InitialSyncDelay: DefaultInitialSyncDelay,
+		SyncJitterFactor: DefaultSyncJitterFactor,
+		HubWriteQPS:      DefaultHubWriteQPS,
+		HubWriteBurst:    DefaultHubWriteBurst,
+
+		StrategyFailureThreshold:  DefaultStrategyFailureThreshold,
+		StrategyOpenRetryInterval: DefaultStrategyOpenRetryInterval,
+
+		SyncInterval:    DefaultSyncInterval,
+		CommandInterval: DefaultCommandInterval,
+
+		PlacementScoreSmoothing:  DefaultPlacementScoreSmoothing,
+		PlacementScoreHysteresis: DefaultPlacementScoreHysteresis,
+
+		ClusterClaims:      []string{ClaimK8sVersion},
+		ClusterClaimPrefix: DefaultClusterClaimPrefix,
+
+		RestartThreshold: DefaultRestartThreshold,
+		RestartWindow:    DefaultRestartWindow,
+
+		QuotaThreshold: DefaultQuotaThreshold,
+
+		EventReasons: DefaultEventReasons,
+	}
 }
 
 // AddFlags registers the agent flags.
@@ -78,12 +212,158 @@ func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
 		"Installation namespace of addon.")
 	flags.StringVar(&o.AddonName, "addon-name", o.AddonName,
 		"Name of the addon.")
+	flags.StringVar(&o.OutboxDir, "outbox-dir", o.OutboxDir,
+		"Directory where hub writes that failed are buffered until the hub is reachable. Kept in memory when empty.")
+	flags.IntVar(&o.OutboxMaxEntries, "outbox-max-entries", o.OutboxMaxEntries,
+		"Maximum number of hub writes buffered in the outbox.")
+	flags.DurationVar(&o.InitialSyncDelay, "initial-sync-delay", o.InitialSyncDelay,
+		"Maximum random delay before the first sync, to spread agents started together.")
+	flags.Float64Var(&o.SyncJitterFactor, "sync-jitter", o.SyncJitterFactor,
+		"Random jitter added to each sync interval, as a fraction of the interval.")
+	flags.Float32Var(&o.HubWriteQPS, "hub-write-qps", o.HubWriteQPS,
+		"Maximum sustained rate of writes to the hub, in writes per second. Each write is usually a Get and an Update.")
+	flags.IntVar(&o.HubWriteBurst, "hub-write-burst", o.HubWriteBurst,
+		"Maximum burst of writes to the hub.")
+	flags.IntVar(&o.StrategyFailureThreshold, "strategy-failure-threshold", o.StrategyFailureThreshold,
+		"Consecutive failures after which a sync strategy is reported degraded and only retried periodically.")
+	flags.DurationVar(&o.StrategyOpenRetryInterval, "strategy-open-retry-interval", o.StrategyOpenRetryInterval,
+		"How often a degraded sync strategy is retried.")
+	flags.DurationVar(&o.SyncInterval, "sync-interval", o.SyncInterval,
+		"Interval between syncs of strategies without their own interval.")
+	flags.DurationVar(&o.PodReportInterval, "pod-report-interval", o.PodReportInterval,
+		"Interval between pod report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.AddonStatusInterval, "addon-status-interval", o.AddonStatusInterval,
+		"Interval between addon status syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.PlacementScoreInterval, "placement-score-interval", o.PlacementScoreInterval,
+		"Interval between placement score syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.ClusterClaimInterval, "cluster-claim-interval", o.ClusterClaimInterval,
+		"Interval between cluster claim syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.CommandInterval, "command-interval", o.CommandInterval,
+		"Interval between checks for new commands from the hub.")
+	flags.DurationVar(&o.EventsReportInterval, "events-report-interval", o.EventsReportInterval,
+		"Interval between events report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.NodeReportInterval, "node-report-interval", o.NodeReportInterval,
+		"Interval between node report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.WorkloadReportInterval, "workload-report-interval", o.WorkloadReportInterval,
+		"Interval between workload report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.ImageReportInterval, "image-report-interval", o.ImageReportInterval,
+		"Interval between image report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.StorageReportInterval, "storage-report-interval", o.StorageReportInterval,
+		"Interval between storage report syncs. Defaults to --sync-interval.")
+	flags.DurationVar(&o.QuotaReportInterval, "quota-report-interval", o.QuotaReportInterval,
+		"Interval between quota report syncs. Defaults to --sync-interval.")
+	flags.StringVar(&o.PlacementScorersFile, "placement-scorers-file", o.PlacementScorersFile,
+		"JSON file configuring how placement scores are computed. Uses the default scorers when empty.")
+	flags.Float64Var(&o.PlacementScoreSmoothing, "placement-score-smoothing", o.PlacementScoreSmoothing,
+		"Weight of the newest value in the moving average of each placement score, in (0, 1]. 1 disables smoothing.")
+	flags.Int64Var(&o.PlacementScoreHysteresis, "placement-score-hysteresis", o.PlacementScoreHysteresis,
+		"Minimum change, in points, of a smoothed placement score before it is published.")
+	flags.StringSliceVar(&o.ClusterClaims, "cluster-claims", o.ClusterClaims,
+		fmt.Sprintf("Cluster claims to publish, among %s.", strings.Join(ClusterClaimNames(), ", ")))
+	flags.StringVar(&o.ClusterClaimPrefix, "cluster-claim-prefix", o.ClusterClaimPrefix,
+		"Prefix of the names of the published cluster claims.")
+	flags.Int32Var(&o.RestartThreshold, "restart-threshold", o.RestartThreshold,
+		"Restarts of a container within --restart-window that flag its workload in the WorkloadsHealthy condition.")
+	flags.DurationVar(&o.RestartWindow, "restart-window", o.RestartWindow,
+		"Window in which container restarts are counted.")
+	flags.Float64Var(&o.QuotaThreshold, "quota-threshold", o.QuotaThreshold,
+		"Used/hard ratio, in (0, 1], at or above which a ResourceQuota is flagged in the QuotasHealthy condition.")
+	flags.StringSliceVar(&o.EventReasons, "event-reasons", o.EventReasons,
+		"Reasons of the Warning events in the events report. Reports all Warning events when empty.")
+	flags.StringSliceVar(&o.CommandNamespaces, "command-namespaces", o.CommandNamespaces,
+		"Namespaces commands from the hub may read. Commands can't read any namespace when empty.")
+}
+
+// strategyInterval returns the interval of a strategy, falling back to SyncInterval.
+func (o *AgentOptions) strategyInterval(strategy string) time.Duration {
+	if interval := o.strategyIntervals()[strategy]; interval > 0 {
+		return interval
+	}
+	return o.SyncInterval
+}
+
+// strategyIntervals returns the intervals set per strategy, zero when unset.
+func (o *AgentOptions) strategyIntervals() map[string]time.Duration {
+	return map[string]time.Duration{
+		strategyPodReport:      o.PodReportInterval,
+		strategyAddonStatus:    o.AddonStatusInterval,
+		strategyPlacementScore: o.PlacementScoreInterval,
+		strategyClusterClaim:   o.ClusterClaimInterval,
+		strategyCommands:       o.CommandInterval,
+		strategyEventsReport:   o.EventsReportInterval,
+		strategyNodeReport:     o.NodeReportInterval,
+		strategyWorkloadReport: o.WorkloadReportInterval,
+		strategyImageReport:    o.ImageReportInterval,
+		strategyStorageReport:  o.StorageReportInterval,
+		strategyQuotaReport:    o.QuotaReportInterval,
+	}
+}
+
+// Validate checks the flags before the agent starts, so a bad value, e.g. from
+// an AddOnDeploymentConfig, fails fast instead of spinning or stalling syncs.
+func (o *AgentOptions) Validate() error {
+	if o.SyncInterval <= 0 {
+		return fmt.Errorf("--sync-interval must be positive, got %s", o.SyncInterval)
+	}
+	if o.SyncJitterFactor < 0 {
+		return fmt.Errorf("--sync-jitter must not be negative, got %v", o.SyncJitterFactor)
+	}
+	if o.InitialSyncDelay < 0 {
+		return fmt.Errorf("--initial-sync-delay must not be negative, got %s", o.InitialSyncDelay)
+	}
+	intervals := o.strategyIntervals()
+	for _, strategy := range sets.List(sets.KeySet(intervals)) {
+		if intervals[strategy] < 0 {
+			return fmt.Errorf("interval of strategy %s must be positive, got %s", strategy, intervals[strategy])
+		}
+	}
+	if o.StrategyFailureThreshold <= 0 {
+		return fmt.Errorf("--strategy-failure-threshold must be positive, got %d", o.StrategyFailureThreshold)
+	}
+	if o.StrategyOpenRetryInterval <= 0 {
+		return fmt.Errorf("--strategy-open-retry-interval must be positive, got %s", o.StrategyOpenRetryInterval)
+	}
+	if o.HubWriteQPS <= 0 {
+		return fmt.Errorf("--hub-write-qps must be positive, got %v", o.HubWriteQPS)
+	}
+	if o.HubWriteBurst < 1 {
+		return fmt.Errorf("--hub-write-burst must be at least 1, got %d", o.HubWriteBurst)
+	}
+	if o.PlacementScoreSmoothing <= 0 || o.PlacementScoreSmoothing > 1 {
+		return fmt.Errorf("--placement-score-smoothing must be in (0, 1], got %v", o.PlacementScoreSmoothing)
+	}
+	if o.PlacementScoreHysteresis < 0 {
+		return fmt.Errorf("--placement-score-hysteresis must not be negative, got %d", o.PlacementScoreHysteresis)
+	}
+	if o.OutboxMaxEntries <= 0 {
+		return fmt.Errorf("--outbox-max-entries must be positive, got %d", o.OutboxMaxEntries)
+	}
+	if o.RestartThreshold <= 0 {
+		return fmt.Errorf("--restart-threshold must be positive, got %d", o.RestartThreshold)
+	}
+	if o.RestartWindow <= 0 {
+		return fmt.Errorf("--restart-window must be positive, got %s", o.RestartWindow)
+	}
+	if o.QuotaThreshold <= 0 || o.QuotaThreshold > 1 {
+		return fmt.Errorf("--quota-threshold must be in (0, 1], got %v", o.QuotaThreshold)
+	}
+	return validateClusterClaims(o.ClusterClaimPrefix, o.ClusterClaims)
+}
+
+// maxStrategyInterval returns the longest time between two runs of a strategy,
+// including the jitter added to each interval.
+func (o *AgentOptions) maxStrategyInterval(strategy string) time.Duration {
+	return time.Duration(float64(o.strategyInterval(strategy)) * (1 + o.SyncJitterFactor))
 }
 
 // RunAgent starts the agent that collects pod info and sends to hub.
 func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) error {
 	klog.Info("Starting basic-addon agent")
 
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
 	// Build spoke client (local cluster)
 	spokeClient, err := kubernetes.NewForConfig(kubeconfig)
 	if err != nil {
@@ -97,66 +377,258 @@ func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) er
 		return err
 	}
 
-	// Build hub client
-	hubRestConfig, err := clientcmd.BuildConfigFromFlags("", o.HubKubeconfigFile)
-	if err != nil {
-		return err
-	}
-	hubClient, err := kubernetes.NewForConfig(hubRestConfig)
+	// Build hub clients, rebuilt when the hub kubeconfig or its certificates rotate
+	hubClients, err := newHubClients(o.HubKubeconfigFile)
 	if err != nil {
 		return err
 	}
 	klog.Infof("Connected to hub cluster, will report to namespace: %s", o.SpokeClusterName)
 
-	// Build hub dynamic client (for AddOn Status and PlacementScore)
-	hubDynamicClient, err := dynamic.NewForConfig(hubRestConfig)
+	go func() {
+		if err := hubClients.watch(ctx); err != nil {
+			klog.Errorf("Failed to watch hub kubeconfig, rotated credentials require a restart: %v", err)
+		}
+	}()
+
+	// Syncs stop when the addon is uninstalled, so they don't recreate what the
+	// cleanup Job deletes
+	syncCtx, stopSyncs := context.WithCancel(ctx)
+	defer stopSyncs()
+	go o.waitForUninstall(syncCtx, spokeClient, stopSyncs)
+
+	// Hub writes that fail are buffered in the outbox and retried with backoff
+	outbox, err := newOutbox(o.OutboxDir, o.OutboxMaxEntries)
 	if err != nil {
 		return err
 	}
+	o.registerPublishers(outbox, hubClients)
+	go outbox.run(syncCtx)
 
-	// Start sync loop
-	ticker := time.NewTicker(SyncInterval)
-	defer ticker.Stop()
-
-	// Run immediately once, then on ticker
-	o.runAllSyncs(ctx, spokeClient, hubClient, spokeDynamicClient, hubDynamicClient)
+	// Workloads are read from informer caches, kept up to date by watches
+	informerFactory := informers.NewSharedInformerFactory(spokeClient, 0)
+	workloads := newWorkloadListers(informerFactory)
+	informerFactory.Start(syncCtx.Done())
+	for informerType, synced := range informerFactory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync the %v informer cache", informerType)
+		}
+	}
 
-	for {
+	// Spread the first sync of agents started together, e.g. after a mass rollout
+	if o.InitialSyncDelay > 0 {
+		delay := time.Duration(rand.Int63n(int64(o.InitialSyncDelay)))
+		klog.Infof("Delaying first sync by %s", delay)
 		select {
-		case <-ctx.Done():
-			klog.Info("Agent shutting down")
-			return nil
-		case <-ticker.C:
-			o.runAllSyncs(ctx, spokeClient, hubClient, spokeDynamicClient, hubDynamicClient)
+		case <-syncCtx.Done():
+		case <-time.After(delay):
 		}
 	}
+
+	// Failing strategies back off exponentially and are reported on the addon
+	breaker := newStrategyBreaker(o.StrategyFailureThreshold, o.strategyInterval, o.StrategyOpenRetryInterval)
+	o.publishStrategiesCondition(syncCtx, breaker, outbox)
+
+	// Run each strategy immediately once, then every jittered strategy interval
+	var wg sync.WaitGroup
+	for _, strategy := range o.syncStrategies(spokeClient, spokeDynamicClient, hubClients, workloads, outbox) {
+		wg.Add(1)
+		go func(strategy syncStrategy) {
+			defer wg.Done()
+			interval := o.strategyInterval(strategy.name)
+			klog.Infof("Syncing %s every %s", strategy.name, interval)
+			wait.JitterUntilWithContext(syncCtx, func(ctx context.Context) {
+				if o.runStrategy(breaker, strategy.name, func() error { return strategy.sync(ctx) }) {
+					o.publishStrategiesCondition(ctx, breaker, outbox)
+				}
+			}, interval, o.SyncJitterFactor, true)
+		}(strategy)
+	}
+	wg.Wait()
+
+	// Stay up, idle, until the agent Deployment is removed
+	<-ctx.Done()
+	klog.Info("Agent shutting down")
+	return nil
 }
 
-// runAllSyncs executes all sync operations and logs errors individually.
-func (o *AgentOptions) runAllSyncs(ctx context.Context, spokeClient, hubClient kubernetes.Interface, spokeDynamicClient, hubDynamicClient dynamic.Interface) {
-	// Strategy 1: ConfigMap (existing)
-	if err := o.syncPodReport(ctx, spokeClient, hubClient); err != nil {
-		klog.Errorf("Failed to sync pod report: %v", err)
+// registerPublishers sets the functions that write each strategy's payload to the hub.
+// All of them share a token bucket, so the agent never writes to the hub
+// faster than HubWriteQPS, including when the outbox replays buffered writes.
+func (o *AgentOptions) registerPublishers(outbox *outbox, hubClients *hubClients) {
+	limiter := o.hubWriteLimiter()
+
+	outbox.register(strategyPodReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishPodReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyAddonStatus, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		_, hubDynamicClient := hubClients.clients()
+		return o.publishAddonStatus(ctx, hubDynamicClient, payload)
+	}))
+	outbox.register(strategyPlacementScore, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		_, hubDynamicClient := hubClients.clients()
+		return o.publishPlacementScore(ctx, hubDynamicClient, payload)
+	}))
+	outbox.register(strategyCommands, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		_, hubDynamicClient := hubClients.clients()
+		return o.publishCommandStatus(ctx, hubDynamicClient, payload)
+	}))
+	outbox.register(strategyEventsReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishEventsReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyNodeReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishNodeReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyWorkloadReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishWorkloadReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyImageReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishImageReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyStorageReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishStorageReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyQuotaReport, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishQuotaReport(ctx, hubClient, payload)
+	}))
+	outbox.register(strategyLogBundles, rateLimited(limiter, func(ctx context.Context, payload []byte) error {
+		hubClient, _ := hubClients.clients()
+		return o.publishLogBundle(ctx, hubClient, payload)
+	}))
+}
+
+// hubWriteLimiter returns the token bucket shared by all hub writes. A token
+// pays for one publish, which is usually a Get and an Update of the object, so
+// the hub sees up to twice HubWriteQPS requests per second from each agent.
+func (o *AgentOptions) hubWriteLimiter() flowcontrol.RateLimiter {
+	return flowcontrol.NewTokenBucketRateLimiter(o.HubWriteQPS, o.HubWriteBurst)
+}
+
+// rateLimited waits for a token from the limiter before publishing.
+func rateLimited(limiter flowcontrol.RateLimiter, publish publishFunc) publishFunc {
+	return func(ctx context.Context, payload []byte) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		return publish(ctx, payload)
+	}
+}
+
+// syncStrategy is a sync operation run on its own interval.
+type syncStrategy struct {
+	name string
+	sync func(ctx context.Context) error
+}
+
+// syncStrategies returns all sync operations of the agent.
+func (o *AgentOptions) syncStrategies(spokeClient kubernetes.Interface, spokeDynamicClient dynamic.Interface,
+	hubClients *hubClients, workloads *workloadListers, outbox *outbox) []syncStrategy {
+	smoother := newScoreSmoother(o.PlacementScoreSmoothing, o.PlacementScoreHysteresis,
+		func(ctx context.Context) ([]interface{}, error) {
+			_, hubDynamicClient := hubClients.clients()
+			return o.lastPublishedScores(ctx, hubDynamicClient, outbox)
+		})
+	commands := newCommandRunner(o.commandActions(spokeClient, outbox), maxConcurrentCommands)
+	restarts := newRestartTracker(o.RestartThreshold, o.RestartWindow)
+	// The storage report and the placement score share the volume stats, read
+	// from the kubelets once per run of the more frequent of the two
+	volumeStats := newVolumeStatsCache(kubeletVolumeStats(spokeClient, kubeletStatsTimeout),
+		min(o.strategyInterval(strategyStorageReport), o.strategyInterval(strategyPlacementScore))).get
+
+	return []syncStrategy{
+		// Strategy 1: ConfigMap (existing)
+		{name: strategyPodReport, sync: func(ctx context.Context) error {
+			return o.syncPodReport(ctx, spokeClient, outbox)
+		}},
+		// Strategy 2: AddOn Status
+		{name: strategyAddonStatus, sync: func(ctx context.Context) error {
+			return o.syncAddonStatus(ctx, spokeClient, restarts, outbox)
+		}},
+		// Strategy 3: AddOnPlacementScore
+		{name: strategyPlacementScore, sync: func(ctx context.Context) error {
+			return o.syncPlacementScore(ctx, spokeClient, volumeStats, outbox, smoother)
+		}},
+		// Strategy 4: ClusterClaim (applies to spoke, klusterlet syncs to hub)
+		{name: strategyClusterClaim, sync: func(ctx context.Context) error {
+			return o.syncClusterClaim(ctx, spokeClient, spokeDynamicClient)
+		}},
+		// Warning events of the spoke, in a ConfigMap like the pod report
+		{name: strategyEventsReport, sync: func(ctx context.Context) error {
+			return o.syncEventsReport(ctx, spokeClient, outbox)
+		}},
+		// Node health, in a ConfigMap and the NodesHealthy condition
+		{name: strategyNodeReport, sync: func(ctx context.Context) error {
+			return o.syncNodeReport(ctx, spokeClient, outbox)
+		}},
+		// Workload inventory, from the informer caches
+		{name: strategyWorkloadReport, sync: func(ctx context.Context) error {
+			return o.syncWorkloadReport(ctx, workloads, outbox)
+		}},
+		// Images of the running containers, with their digests
+		{name: strategyImageReport, sync: func(ctx context.Context) error {
+			return o.syncImageReport(ctx, spokeClient, outbox)
+		}},
+		// PVCs and StorageClasses, with the volume stats of the kubelets
+		{name: strategyStorageReport, sync: func(ctx context.Context) error {
+			return o.syncStorageReport(ctx, spokeClient, volumeStats, outbox)
+		}},
+		// ResourceQuota utilization, in a ConfigMap and the QuotasHealthy condition
+		{name: strategyQuotaReport, sync: func(ctx context.Context) error {
+			return o.syncQuotaReport(ctx, spokeClient, outbox)
+		}},
+		// Commands from the hub, run on demand
+		{name: strategyCommands, sync: func(ctx context.Context) error {
+			_, hubDynamicClient := hubClients.clients()
+			return o.syncCommands(ctx, hubDynamicClient, commands, outbox)
+		}},
 	}
+}
 
-	// Strategy 2: AddOn Status
-	if err := o.syncAddonStatus(ctx, spokeClient, hubDynamicClient); err != nil {
-		klog.Errorf("Failed to sync addon status: %v", err)
+// runStrategy runs the sync unless the strategy is backing off, and records
+// the result. It returns whether the strategy's circuit opened or closed.
+func (o *AgentOptions) runStrategy(breaker *strategyBreaker, strategy string, syncFunc func() error) bool {
+	if !breaker.allow(strategy) {
+		klog.V(4).Infof("Skipping %s sync, backing off after failures", strategy)
+		return false
 	}
 
-	// Strategy 3: AddOnPlacementScore
-	if err := o.syncPlacementScore(ctx, spokeClient, hubDynamicClient); err != nil {
-		klog.Errorf("Failed to sync placement score: %v", err)
+	err := syncFunc()
+	wasOpen := breaker.isOpen(strategy)
+	opened, closed := breaker.record(strategy, err)
+	switch {
+	case opened:
+		klog.Errorf("Sync strategy %s is degraded after %d consecutive failures, retrying every %s: %v",
+			strategy, o.StrategyFailureThreshold, o.StrategyOpenRetryInterval, err)
+	case closed:
+		klog.Infof("Sync strategy %s recovered", strategy)
+	case err != nil && wasOpen:
+		klog.V(2).Infof("Degraded sync strategy %s still failing: %v", strategy, err)
+	case err != nil:
+		klog.Errorf("Failed to sync %s: %v", strategy, err)
 	}
+	return opened || closed
+}
 
-	// Strategy 4: ClusterClaim (applies to spoke, klusterlet syncs to hub)
-	if err := o.syncClusterClaim(ctx, spokeClient, spokeDynamicClient); err != nil {
-		klog.Errorf("Failed to sync cluster claim: %v", err)
+// publishStrategiesCondition reports the degraded strategies on the addon status.
+func (o *AgentOptions) publishStrategiesCondition(ctx context.Context, breaker *strategyBreaker, outbox *outbox) {
+	payload, err := breaker.conditionPayload()
+	if err != nil {
+		klog.Errorf("Failed to build %s condition: %v", StrategiesHealthyConditionType, err)
+		return
+	}
+	if err := outbox.publish(ctx, strategyAddonStatus, StrategiesHealthyConditionType, payload); err != nil {
+		klog.Errorf("Failed to publish %s condition: %v", StrategiesHealthyConditionType, err)
 	}
 }
 
 // syncPodReport collects pods from spoke and sends report to hub.
-func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient, hubClient kubernetes.Interface) error {
+func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox) error {
 	klog.V(4).Info("Syncing pod report")
 
 	// List all pods in the spoke cluster
@@ -165,8 +637,20 @@ func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient, hubClient
 		return err
 	}
 
+	// FailedScheduling events explain the pending pods. The report is still
+	// sent without them when they can't be listed.
+	var events []corev1.Event
+	eventList, err := spokeClient.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("reason", failedSchedulingReason).String(),
+	})
+	if err != nil {
+		klog.Warningf("Failed to list %s events: %v", failedSchedulingReason, err)
+	} else {
+		events = eventList.Items
+	}
+
 	// Build pod report
-	report := buildPodReport(o.SpokeClusterName, podList.Items)
+	report := buildPodReport(o.SpokeClusterName, podList.Items, events)
 
 	// Serialize to JSON
 	reportJSON, err := json.Marshal(report)
@@ -174,10 +658,20 @@ func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient, hubClient
 		return err
 	}
 
-	// Create or update ConfigMap in hub
+	return outbox.publish(ctx, strategyPodReport, PodReportConfigMapName, reportJSON)
+}
+
+// publishPodReport creates or updates the pod report ConfigMap in hub.
+func (o *AgentOptions) publishPodReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, PodReportConfigMapName, reportJSON)
+}
+
+// applyReportConfigMap creates or updates a report ConfigMap in the cluster
+// namespace on the hub, with the report in its "report" key.
+func (o *AgentOptions) applyReportConfigMap(ctx context.Context, hubClient kubernetes.Interface, name string, reportJSON []byte) error {
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      PodReportConfigMapName,
+			Name:      name,
 			Namespace: o.SpokeClusterName,
 			Labels: map[string]string{
 				"app":                          "basic-addon",
@@ -189,13 +683,13 @@ func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient, hubClient
 		},
 	}
 
-	existing, err := hubClient.CoreV1().ConfigMaps(o.SpokeClusterName).Get(ctx, PodReportConfigMapName, metav1.GetOptions{})
+	existing, err := hubClient.CoreV1().ConfigMaps(o.SpokeClusterName).Get(ctx, name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		_, err = hubClient.CoreV1().ConfigMaps(o.SpokeClusterName).Create(ctx, configMap, metav1.CreateOptions{})
 		if err != nil {
 			return err
 		}
-		klog.Infof("Created pod report ConfigMap with %d pods", len(report.Pods))
+		klog.Infof("Created %s ConfigMap (%d bytes)", name, len(reportJSON))
 		return nil
 	}
 	if err != nil {
@@ -208,26 +702,50 @@ func (o *AgentOptions) syncPodReport(ctx context.Context, spokeClient, hubClient
 	if err != nil {
 		return err
 	}
-	klog.Infof("Updated pod report ConfigMap with %d pods", len(report.Pods))
+	klog.Infof("Updated %s ConfigMap (%d bytes)", name, len(reportJSON))
 	return nil
 }
 
-// buildPodReport creates a PodReport from a list of pods.
-func buildPodReport(clusterName string, pods []corev1.Pod) PodReport {
+// buildPodReport creates a PodReport from a list of pods, explaining the
+// pending pods with their PodScheduled condition and FailedScheduling events.
+func buildPodReport(clusterName string, pods []corev1.Pod, events []corev1.Event) PodReport {
+	eventsByPod := failedSchedulingEvents(events)
+	causes := map[string]int{}
+	pending := 0
+
 	podInfos := make([]PodInfo, 0, len(pods))
 	for _, pod := range pods {
+		scheduling := schedulingInfo(&pod, podEvents(&pod, eventsByPod))
+		if scheduling != nil {
+			pending++
+			for _, cause := range scheduling.Causes {
+				causes[cause]++
+			}
+		}
 		podInfos = append(podInfos, PodInfo{
-			Name:      pod.Name,
-			Namespace: pod.Namespace,
-			Status:    string(pod.Status.Phase),
-			NodeName:  pod.Spec.NodeName,
+			Name:       pod.Name,
+			Namespace:  pod.Namespace,
+			Status:     string(pod.Status.Phase),
+			NodeName:   pod.Spec.NodeName,
+			Scheduling: scheduling,
 		})
 	}
 
-	return PodReport{
-		ClusterName: clusterName,
-		Timestamp:   time.Now().UTC(),
-		TotalPods:   len(pods),
-		Pods:        podInfos,
+	report := PodReport{
+		ClusterName:      clusterName,
+		Timestamp:        time.Now().UTC(),
+		TotalPods:        len(pods),
+		PendingPods:      pending,
+		SchedulingCauses: causes,
+		Pods:             podInfos,
+	}
+	if len(report.Pods) > maxPodReportEntries {
+		// Pending pods are the ones worth looking at, keep them
+		sort.SliceStable(report.Pods, func(i, j int) bool {
+			return report.Pods[i].Scheduling != nil && report.Pods[j].Scheduling == nil
+		})
+		report.Pods = report.Pods[:maxPodReportEntries]
+		report.Truncated = true
 	}
+	return report
 }
@@ -1,6 +1,9 @@
 package agent
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,7 +81,7 @@ func TestBuildPodReport(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			report := buildPodReport(tt.clusterName, tt.pods)
+			report := buildPodReport(tt.clusterName, tt.pods, nil)
 
 			if report.ClusterName != tt.clusterName {
 				t.Errorf("ClusterName = %s, want %s", report.ClusterName, tt.clusterName)
@@ -103,6 +106,33 @@ func TestBuildPodReport(t *testing.T) {
 	}
 }
 
+func TestBuildPodReportTruncated(t *testing.T) {
+	pods := make([]corev1.Pod, maxPodReportEntries+1)
+	for i := range pods {
+		pods[i] = corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod%d", i), Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	// The last pod is pending: it must be kept
+	pods[maxPodReportEntries].Status = corev1.PodStatus{
+		Phase:      corev1.PodPending,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}},
+	}
+
+	report := buildPodReport("cluster1", pods, nil)
+
+	if !report.Truncated || len(report.Pods) != maxPodReportEntries {
+		t.Fatalf("Truncated = %v with %d pods, want true with %d", report.Truncated, len(report.Pods), maxPodReportEntries)
+	}
+	if report.TotalPods != maxPodReportEntries+1 {
+		t.Errorf("TotalPods = %d, want %d", report.TotalPods, maxPodReportEntries+1)
+	}
+	if report.Pods[0].Name != pods[maxPodReportEntries].Name {
+		t.Errorf("first pod = %s, want the pending pod %s", report.Pods[0].Name, pods[maxPodReportEntries].Name)
+	}
+}
+
 func TestBuildPodReportPodInfo(t *testing.T) {
 	pods := []corev1.Pod{
 		{
@@ -119,7 +149,7 @@ func TestBuildPodReportPodInfo(t *testing.T) {
 		},
 	}
 
-	report := buildPodReport("test-cluster", pods)
+	report := buildPodReport("test-cluster", pods, nil)
 
 	if len(report.Pods) != 1 {
 		t.Fatalf("expected 1 pod info, got %d", len(report.Pods))
@@ -163,3 +193,96 @@ func TestNewAgentOptions(t *testing.T) {
 		t.Errorf("AddonNamespace should be empty by default")
 	}
 }
+
+func TestAgentOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(o *AgentOptions)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(o *AgentOptions) {}},
+		{name: "zero strategy interval falls back to sync interval", modify: func(o *AgentOptions) { o.PodReportInterval = 0 }},
+		{name: "zero sync interval", modify: func(o *AgentOptions) { o.SyncInterval = 0 }, wantErr: "--sync-interval"},
+		{name: "negative sync interval", modify: func(o *AgentOptions) { o.SyncInterval = -time.Second }, wantErr: "--sync-interval"},
+		{name: "negative strategy interval", modify: func(o *AgentOptions) { o.NodeReportInterval = -time.Second }, wantErr: strategyNodeReport},
+		{name: "negative sync jitter", modify: func(o *AgentOptions) { o.SyncJitterFactor = -0.1 }, wantErr: "--sync-jitter"},
+		{name: "negative initial sync delay", modify: func(o *AgentOptions) { o.InitialSyncDelay = -time.Second }, wantErr: "--initial-sync-delay"},
+		{name: "zero failure threshold", modify: func(o *AgentOptions) { o.StrategyFailureThreshold = 0 }, wantErr: "--strategy-failure-threshold"},
+		{name: "zero open retry interval", modify: func(o *AgentOptions) { o.StrategyOpenRetryInterval = 0 }, wantErr: "--strategy-open-retry-interval"},
+		{name: "zero qps", modify: func(o *AgentOptions) { o.HubWriteQPS = 0 }, wantErr: "--hub-write-qps"},
+		{name: "negative qps", modify: func(o *AgentOptions) { o.HubWriteQPS = -1 }, wantErr: "--hub-write-qps"},
+		{name: "zero burst", modify: func(o *AgentOptions) { o.HubWriteBurst = 0 }, wantErr: "--hub-write-burst"},
+		{name: "zero smoothing", modify: func(o *AgentOptions) { o.PlacementScoreSmoothing = 0 }, wantErr: "--placement-score-smoothing"},
+		{name: "smoothing above 1", modify: func(o *AgentOptions) { o.PlacementScoreSmoothing = 1.5 }, wantErr: "--placement-score-smoothing"},
+		{name: "smoothing of 1", modify: func(o *AgentOptions) { o.PlacementScoreSmoothing = 1 }},
+		{name: "negative hysteresis", modify: func(o *AgentOptions) { o.PlacementScoreHysteresis = -1 }, wantErr: "--placement-score-hysteresis"},
+		{name: "zero quota threshold", modify: func(o *AgentOptions) { o.QuotaThreshold = 0 }, wantErr: "--quota-threshold"},
+		{name: "quota threshold above 1", modify: func(o *AgentOptions) { o.QuotaThreshold = 90 }, wantErr: "--quota-threshold"},
+		{name: "quota threshold of 1", modify: func(o *AgentOptions) { o.QuotaThreshold = 1 }},
+		{name: "zero outbox entries", modify: func(o *AgentOptions) { o.OutboxMaxEntries = 0 }, wantErr: "--outbox-max-entries"},
+		{name: "zero restart threshold", modify: func(o *AgentOptions) { o.RestartThreshold = 0 }, wantErr: "--restart-threshold"},
+		{name: "negative restart window", modify: func(o *AgentOptions) { o.RestartWindow = -time.Minute }, wantErr: "--restart-window"},
+		{name: "unknown cluster claim", modify: func(o *AgentOptions) { o.ClusterClaims = []string{"unknown"} }, wantErr: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewAgentOptions("test-addon")
+			tt.modify(opts)
+			err := opts.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHubWriteLimiter(t *testing.T) {
+	opts := NewAgentOptions("test-addon")
+	opts.HubWriteQPS = 20
+	opts.HubWriteBurst = 2
+
+	writes := 0
+	publish := rateLimited(opts.hubWriteLimiter(), func(ctx context.Context, payload []byte) error {
+		writes++
+		return nil
+	})
+
+	// The burst goes through right away, the rest is held to HubWriteQPS
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := publish(context.TODO(), nil); err != nil {
+			t.Fatalf("publish() error = %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+	if writes != 6 {
+		t.Errorf("writes = %d, want 6", writes)
+	}
+	// 4 writes beyond the burst at 20 per second take at least 200ms
+	if elapsed < 180*time.Millisecond {
+		t.Errorf("6 writes took %s, want them held to 20 per second after a burst of 2", elapsed)
+	}
+}
+
+func TestStrategyInterval(t *testing.T) {
+	opts := NewAgentOptions("test-addon")
+	opts.SyncInterval = 2 * time.Minute
+	opts.PlacementScoreInterval = 5 * time.Minute
+	opts.SyncJitterFactor = 0.2
+
+	if got := opts.strategyInterval(strategyPodReport); got != 2*time.Minute {
+		t.Errorf("pod report interval = %s, want 2m", got)
+	}
+	if got := opts.strategyInterval(strategyPlacementScore); got != 5*time.Minute {
+		t.Errorf("placement score interval = %s, want 5m", got)
+	}
+	if got := opts.maxStrategyInterval(strategyPlacementScore); got != 6*time.Minute {
+		t.Errorf("max placement score interval = %s, want 6m", got)
+	}
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// clusterCapacity is the allocatable capacity of the schedulable nodes and the
+// part of it already requested by the pods running on them.
+type clusterCapacity struct {
+	allocatableCPUMillis int64
+	requestedCPUMillis   int64
+	allocatableMemory    int64
+	requestedMemory      int64
+	allocatablePods      int64
+	requestedPods        int64
+}
+
+// computeClusterCapacity sums the allocatable resources of the schedulable nodes
+// and the requests of the non-terminated pods bound to them.
+func computeClusterCapacity(nodes []corev1.Node, pods []corev1.Pod) clusterCapacity {
+	capacity := clusterCapacity{}
+	schedulable := sets.New[string]()
+	for _, node := range nodes {
+		if !isNodeSchedulable(&node) {
+			continue
+		}
+		schedulable.Insert(node.Name)
+		capacity.allocatableCPUMillis += node.Status.Allocatable.Cpu().MilliValue()
+		capacity.allocatableMemory += node.Status.Allocatable.Memory().Value()
+		capacity.allocatablePods += node.Status.Allocatable.Pods().Value()
+	}
+
+	for _, pod := range pods {
+		if !schedulable.Has(pod.Spec.NodeName) {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		requests := podRequests(&pod)
+		capacity.requestedCPUMillis += requests.Cpu().MilliValue()
+		capacity.requestedMemory += requests.Memory().Value()
+		capacity.requestedPods++
+	}
+	return capacity
+}
+
+func (c clusterCapacity) freeCPUMillis() int64 {
+	return max(c.allocatableCPUMillis-c.requestedCPUMillis, 0)
+}
+
+func (c clusterCapacity) freeMemory() int64 {
+	return max(c.allocatableMemory-c.requestedMemory, 0)
+}
+
+func (c clusterCapacity) freePods() int64 {
+	return max(c.allocatablePods-c.requestedPods, 0)
+}
+
+// headroomRatio returns the free fraction of the scarcest resource, in [0, 1].
+func (c clusterCapacity) headroomRatio() float64 {
+	if c.allocatableCPUMillis == 0 || c.allocatableMemory == 0 || c.allocatablePods == 0 {
+		return 0
+	}
+	return min(
+		float64(c.freeCPUMillis())/float64(c.allocatableCPUMillis),
+		float64(c.freeMemory())/float64(c.allocatableMemory),
+		float64(c.freePods())/float64(c.allocatablePods),
+	)
+}
+
+// isNodeSchedulable returns whether new pods can be placed on the node.
+func isNodeSchedulable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podRequests returns the resources the scheduler reserves for the pod: the
+// larger of the summed app container requests and any single init container
+// request, plus the pod overhead.
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, container.Resources.Requests)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	addResources(requests, pod.Spec.Overhead)
+	return requests
+}
+
+func addResources(total, add corev1.ResourceList) {
+	for name, quantity := range add {
+		current, ok := total[name]
+		if !ok {
+			current = resource.Quantity{Format: quantity.Format}
+		}
+		current.Add(quantity)
+		total[name] = current
+	}
+}
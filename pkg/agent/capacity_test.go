@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestComputeClusterCapacity(t *testing.T) {
+	readyNode := func(name, cpu, memory, pods string, unschedulable bool, ready corev1.ConditionStatus) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+			Status: corev1.NodeStatus{
+				Allocatable: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+					corev1.ResourcePods:   resource.MustParse(pods),
+				},
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	pod := func(node string, phase corev1.PodPhase, cpu, memory string) corev1.Pod {
+		return corev1.Pod{
+			Spec: corev1.PodSpec{
+				NodeName: node,
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(memory),
+					}},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		nodes        []corev1.Node
+		pods         []corev1.Pod
+		wantCapacity clusterCapacity
+		wantHeadroom float64
+	}{
+		{
+			name:         "no nodes",
+			wantCapacity: clusterCapacity{},
+		},
+		{
+			name: "requests of running pods are subtracted",
+			nodes: []corev1.Node{
+				readyNode("node1", "4", "8Gi", "100", false, corev1.ConditionTrue),
+				readyNode("node2", "4", "8Gi", "100", false, corev1.ConditionTrue),
+			},
+			pods: []corev1.Pod{
+				pod("node1", corev1.PodRunning, "2", "4Gi"),
+				pod("node2", corev1.PodPending, "2", "4Gi"),
+				pod("node2", corev1.PodSucceeded, "2", "4Gi"),
+				pod("", corev1.PodPending, "2", "4Gi"),
+			},
+			wantCapacity: clusterCapacity{
+				allocatableCPUMillis: 8000, requestedCPUMillis: 4000,
+				allocatableMemory: 16 << 30, requestedMemory: 8 << 30,
+				allocatablePods: 200, requestedPods: 2,
+			},
+			wantHeadroom: 0.5,
+		},
+		{
+			name: "unschedulable and not ready nodes are ignored",
+			nodes: []corev1.Node{
+				readyNode("node1", "4", "8Gi", "100", false, corev1.ConditionTrue),
+				readyNode("cordoned", "4", "8Gi", "100", true, corev1.ConditionTrue),
+				readyNode("notready", "4", "8Gi", "100", false, corev1.ConditionFalse),
+			},
+			pods: []corev1.Pod{
+				pod("node1", corev1.PodRunning, "1", "2Gi"),
+				pod("cordoned", corev1.PodRunning, "2", "4Gi"),
+			},
+			wantCapacity: clusterCapacity{
+				allocatableCPUMillis: 4000, requestedCPUMillis: 1000,
+				allocatableMemory: 8 << 30, requestedMemory: 2 << 30,
+				allocatablePods: 100, requestedPods: 1,
+			},
+			wantHeadroom: 0.75,
+		},
+		{
+			name:  "overcommitted cluster has no headroom",
+			nodes: []corev1.Node{readyNode("node1", "1", "8Gi", "100", false, corev1.ConditionTrue)},
+			pods:  []corev1.Pod{pod("node1", corev1.PodRunning, "2", "1Gi")},
+			wantCapacity: clusterCapacity{
+				allocatableCPUMillis: 1000, requestedCPUMillis: 2000,
+				allocatableMemory: 8 << 30, requestedMemory: 1 << 30,
+				allocatablePods: 100, requestedPods: 1,
+			},
+			wantHeadroom: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capacity := computeClusterCapacity(tt.nodes, tt.pods)
+			if capacity != tt.wantCapacity {
+				t.Errorf("computeClusterCapacity() = %+v, want %+v", capacity, tt.wantCapacity)
+			}
+			if headroom := capacity.headroomRatio(); headroom != tt.wantHeadroom {
+				t.Errorf("headroomRatio() = %v, want %v", headroom, tt.wantHeadroom)
+			}
+		})
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("2"),
+				}},
+			}},
+			Containers: []corev1.Container{
+				{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				}}},
+				{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				}}},
+			},
+			Overhead: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		},
+	}
+
+	requests := podRequests(pod)
+	if cpu := requests.Cpu().MilliValue(); cpu != 2100 {
+		t.Errorf("cpu request = %dm, want 2100m", cpu)
+	}
+	if memory := requests.Memory().Value(); memory != 2<<30 {
+		t.Errorf("memory request = %d, want %d", memory, 2<<30)
+	}
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CleanupJobName is the pre-delete hook Job that removes what the addon
+	// wrote. The agent stops syncing as soon as it exists, so it doesn't
+	// recreate what the Job deletes.
+	CleanupJobName = "basic-addon-cleanup"
+
+	// uninstallPollInterval is how often the agent checks for the cleanup Job.
+	uninstallPollInterval = 5 * time.Second
+	// DefaultCleanupGracePeriod gives the agent time to notice the cleanup Job
+	// and finish its in-flight writes before they are deleted.
+	DefaultCleanupGracePeriod = 3 * uninstallPollInterval
+)
+
+// NewCleanupCommand creates the subcommand run by the pre-delete hook Job. It
+// deletes the ClusterClaims of the agent on the spoke and its reports and
+// placement score on the hub. The log bundles and AddonCommands are left to
+// the hub controller: the agent Role can only create log bundles and never
+// deletes commands, which belong to the hub operators. The controller deletes
+// expired bundles and completed commands, and a bundle is deleted with its command.
+func NewCleanupCommand(addonName string) *cobra.Command {
+	o := NewAgentOptions(addonName)
+	gracePeriod := DefaultCleanupGracePeriod
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove everything the addon agent wrote, before the addon is uninstalled",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(o.SpokeClusterName) == 0 {
+				return fmt.Errorf("--cluster-name is required")
+			}
+
+			// In-cluster config of the spoke
+			spokeConfig, err := clientcmd.BuildConfigFromFlags("", "")
+			if err != nil {
+				return err
+			}
+			spokeDynamicClient, err := dynamic.NewForConfig(spokeConfig)
+			if err != nil {
+				return err
+			}
+			hubClients, err := newHubClients(o.HubKubeconfigFile)
+			if err != nil {
+				return err
+			}
+			hubClient, hubDynamicClient := hubClients.clients()
+
+			klog.Infof("Waiting %s for the agent to stop syncing", gracePeriod)
+			select {
+			case <-cmd.Context().Done():
+				return cmd.Context().Err()
+			case <-time.After(gracePeriod):
+			}
+
+			return o.cleanup(cmd.Context(), spokeDynamicClient, hubClient, hubDynamicClient)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&o.HubKubeconfigFile, "hub-kubeconfig", o.HubKubeconfigFile,
+		"Location of kubeconfig file to connect to hub cluster.")
+	flags.StringVar(&o.SpokeClusterName, "cluster-name", o.SpokeClusterName,
+		"Name of the spoke cluster.")
+	flags.DurationVar(&gracePeriod, "grace-period", gracePeriod,
+		"Time given to the agent to stop syncing before its objects are removed.")
+	return cmd
+}
+
+// cleanup deletes the ClusterClaims of the agent on the spoke, found by label
+// whatever their prefix, and the report ConfigMaps and the placement score in
+// the cluster namespace on the hub.
+func (o *AgentOptions) cleanup(ctx context.Context, spokeDynamicClient dynamic.Interface,
+	hubClient kubernetes.Interface, hubDynamicClient dynamic.Interface) error {
+	claims, err := spokeDynamicClient.Resource(claimGVR).List(ctx, metav1.ListOptions{LabelSelector: "app=basic-addon"})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to list cluster claims: %w", err)
+	}
+	if err == nil {
+		for _, claim := range claims.Items {
+			if err := spokeDynamicClient.Resource(claimGVR).Delete(ctx, claim.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete cluster claim %s: %w", claim.GetName(), err)
+			}
+			klog.Infof("Deleted ClusterClaim %s", claim.GetName())
+		}
+	}
+
+	// The agent Role only allows access to these objects by name
+	for _, name := range ReportConfigMapNames() {
+		err := hubClient.CoreV1().ConfigMaps(o.SpokeClusterName).Delete(ctx, name, metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete report ConfigMap %s: %w", name, err)
+		}
+		klog.Infof("Deleted report ConfigMap %s", name)
+	}
+
+	err = hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).Delete(ctx, PlacementScoreName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete placement score: %w", err)
+	}
+	if err == nil {
+		klog.Infof("Deleted AddOnPlacementScore %s", PlacementScoreName)
+	}
+	return nil
+}
+
+// waitForUninstall calls stop once the cleanup Job exists in the addon namespace.
+func (o *AgentOptions) waitForUninstall(ctx context.Context, spokeClient kubernetes.Interface, stop context.CancelFunc) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		_, err := spokeClient.BatchV1().Jobs(o.AddonNamespace).Get(ctx, CleanupJobName, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+		case err != nil:
+			klog.V(2).Infof("Failed to check for the cleanup Job: %v", err)
+		default:
+			klog.Info("Addon is being uninstalled, stopping syncs")
+			stop()
+		}
+	}, uninstallPollInterval)
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCleanup(t *testing.T) {
+	claim := func(name string, labels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
+			"kind":       "ClusterClaim",
+			"metadata":   map[string]interface{}{"name": name, "labels": labels},
+			"spec":       map[string]interface{}{"value": "v"},
+		}}
+	}
+	owned := map[string]interface{}{"app": "basic-addon"}
+	spokeDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{claimGVR: "ClusterClaimList"},
+		claim(ClusterClaimName, owned),
+		claim("basic-addon.cni", owned),
+		claim("old-prefix.cni", owned),
+		claim("id.k8s.io", nil),
+	)
+	hubClient := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: PodReportConfigMapName, Namespace: "cluster1"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "cluster1"}},
+	)
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{scoreGVR: "AddOnPlacementScoreList"}, newPlacementScore("cluster1"))
+
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	if err := opts.cleanup(context.TODO(), spokeDynamicClient, hubClient, hubDynamicClient); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+
+	claims, _ := spokeDynamicClient.Resource(claimGVR).List(context.TODO(), metav1.ListOptions{})
+	if len(claims.Items) != 1 || claims.Items[0].GetName() != "id.k8s.io" {
+		t.Errorf("remaining cluster claims = %v, want only id.k8s.io", claims.Items)
+	}
+	configMaps, _ := hubClient.CoreV1().ConfigMaps("cluster1").List(context.TODO(), metav1.ListOptions{})
+	if len(configMaps.Items) != 1 || configMaps.Items[0].Name != "other" {
+		t.Errorf("remaining hub ConfigMaps = %v, want only other", configMaps.Items)
+	}
+	if _, err := hubDynamicClient.Resource(scoreGVR).Namespace("cluster1").Get(context.TODO(), PlacementScoreName, metav1.GetOptions{}); err == nil {
+		t.Error("expected the placement score to be deleted")
+	}
+
+	// Running again finds nothing to delete
+	if err := opts.cleanup(context.TODO(), spokeDynamicClient, hubClient, hubDynamicClient); err != nil {
+		t.Errorf("second cleanup() error = %v", err)
+	}
+}
+
+func TestWaitForUninstall(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: CleanupJobName, Namespace: "open-cluster-management-agent-addon"},
+	})
+	opts := NewAgentOptions("basic-addon")
+	opts.AddonNamespace = "open-cluster-management-agent-addon"
+
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stop()
+	stopped := false
+	opts.waitForUninstall(ctx, spokeClient, func() {
+		stopped = true
+		stop()
+	})
+	if !stopped {
+		t.Error("expected syncs to stop when the cleanup Job exists")
+	}
+}
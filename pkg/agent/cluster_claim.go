@@ -3,10 +3,17 @@ package agent
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -18,55 +25,299 @@ var claimGVR = schema.GroupVersionResource{
 	Resource: "clusterclaims",
 }
 
-const ClusterClaimName = "basic-addon.k8s-version"
+const (
+	// DefaultClusterClaimPrefix is prepended to the name of every claim.
+	DefaultClusterClaimPrefix = "basic-addon."
 
-// syncClusterClaim creates ManagedClusterClaim in the SPOKE cluster.
+	ClusterClaimName = DefaultClusterClaimPrefix + ClaimK8sVersion
+
+	// maxClaimValueLength is the ClusterClaim spec.value limit.
+	maxClaimValueLength = 1024
+)
+
+// Claims of the catalog, named without the prefix.
+const (
+	ClaimK8sVersion          = "k8s-version"
+	ClaimNodeCount           = "node-count"
+	ClaimArchitectures       = "architectures"
+	ClaimOSImages            = "os-images"
+	ClaimContainerRuntimes   = "container-runtimes"
+	ClaimCloudProvider       = "cloud-provider"
+	ClaimRegions             = "regions"
+	ClaimZones               = "zones"
+	ClaimCNI                 = "cni"
+	ClaimDefaultStorageClass = "default-storageclass"
+)
+
+// cniDaemonSets maps the DaemonSet names of known CNI plugins to the plugin.
+var cniDaemonSets = map[string]string{
+	"calico-node":      "calico",
+	"canal":            "canal",
+	"cilium":           "cilium",
+	"kube-flannel-ds":  "flannel",
+	"weave-net":        "weave",
+	"aws-node":         "aws-vpc-cni",
+	"kindnet":          "kindnet",
+	"antrea-agent":     "antrea",
+	"ovnkube-node":     "ovn-kubernetes",
+	"kube-router":      "kube-router",
+	"azure-cni":        "azure-cni",
+	"openshift-sdn":    "openshift-sdn",
+	"sdn":              "openshift-sdn",
+	"kube-ovn-cni":     "kube-ovn",
+	"multus":           "multus",
+	"kube-multus-ds":   "multus",
+	"gke-metadata-cni": "gke",
+}
+
+// claimInput is the spoke state the claim values are computed from.
+type claimInput struct {
+	serverVersion string
+	nodes         []corev1.Node
+}
+
+// claimValueFunc computes the value of a claim. An empty value means the claim
+// doesn't apply to the cluster and is not published.
+type claimValueFunc func(ctx context.Context, spokeClient kubernetes.Interface, input *claimInput) (string, error)
+
+// claimCatalog returns the claims the agent can publish.
+func claimCatalog() map[string]claimValueFunc {
+	return map[string]claimValueFunc{
+		ClaimK8sVersion: func(_ context.Context, _ kubernetes.Interface, input *claimInput) (string, error) {
+			return input.serverVersion, nil
+		},
+		ClaimNodeCount: func(_ context.Context, _ kubernetes.Interface, input *claimInput) (string, error) {
+			return strconv.Itoa(len(input.nodes)), nil
+		},
+		ClaimArchitectures: nodeClaim(func(node *corev1.Node) string { return node.Status.NodeInfo.Architecture }),
+		ClaimOSImages:      nodeClaim(func(node *corev1.Node) string { return node.Status.NodeInfo.OSImage }),
+		ClaimContainerRuntimes: nodeClaim(func(node *corev1.Node) string {
+			return node.Status.NodeInfo.ContainerRuntimeVersion
+		}),
+		ClaimCloudProvider: nodeClaim(func(node *corev1.Node) string {
+			// providerID is <provider>://<provider specific id>
+			provider, _, found := strings.Cut(node.Spec.ProviderID, "://")
+			if !found {
+				return ""
+			}
+			return provider
+		}),
+		ClaimRegions: nodeClaim(func(node *corev1.Node) string { return node.Labels[corev1.LabelTopologyRegion] }),
+		ClaimZones:   nodeClaim(func(node *corev1.Node) string { return node.Labels[corev1.LabelTopologyZone] }),
+		ClaimCNI:     cniClaim,
+		ClaimDefaultStorageClass: func(ctx context.Context, spokeClient kubernetes.Interface, _ *claimInput) (string, error) {
+			storageClasses, err := spokeClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return "", fmt.Errorf("failed to list storage classes: %w", err)
+			}
+			defaults := sets.New[string]()
+			for _, storageClass := range storageClasses.Items {
+				if storageClass.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" ||
+					storageClass.Annotations["storageclass.beta.kubernetes.io/is-default-class"] == "true" {
+					defaults.Insert(storageClass.Name)
+				}
+			}
+			return joinClaimValues(defaults), nil
+		},
+	}
+}
+
+// ClusterClaimNames returns the names of all claims of the catalog, without the prefix.
+func ClusterClaimNames() []string {
+	names := []string{}
+	for name := range claimCatalog() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nodeClaim returns a claim whose value is the sorted distinct node values.
+func nodeClaim(nodeValue func(node *corev1.Node) string) claimValueFunc {
+	return func(_ context.Context, _ kubernetes.Interface, input *claimInput) (string, error) {
+		values := sets.New[string]()
+		for i := range input.nodes {
+			if value := nodeValue(&input.nodes[i]); len(value) > 0 {
+				values.Insert(value)
+			}
+		}
+		return joinClaimValues(values), nil
+	}
+}
+
+// cniClaim detects the CNI plugins from the DaemonSets that run them.
+func cniClaim(ctx context.Context, spokeClient kubernetes.Interface, _ *claimInput) (string, error) {
+	daemonSets, err := spokeClient.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	plugins := sets.New[string]()
+	for _, daemonSet := range daemonSets.Items {
+		if plugin, ok := cniDaemonSets[daemonSet.Name]; ok {
+			plugins.Insert(plugin)
+		}
+	}
+	return joinClaimValues(plugins), nil
+}
+
+// joinClaimValues joins the values in a comma separated list that fits a claim.
+// Values that don't fit are dropped and the list ends with ",...".
+func joinClaimValues(values sets.Set[string]) string {
+	const truncated = ",..."
+	items := sets.List(values)
+	if value := strings.Join(items, ","); len(value) <= maxClaimValueLength {
+		return value
+	}
+	value := ""
+	for _, item := range items {
+		next := item
+		if len(value) > 0 {
+			next = value + "," + item
+		}
+		if len(next)+len(truncated) > maxClaimValueLength {
+			break
+		}
+		value = next
+	}
+	return value + truncated
+}
+
+// truncateClaimValue cuts a value to the claim value limit.
+func truncateClaimValue(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
+
+// validateClusterClaims checks the claim prefix and the enabled claims.
+func validateClusterClaims(prefix string, claims []string) error {
+	catalog := claimCatalog()
+	for _, claim := range claims {
+		if _, ok := catalog[claim]; !ok {
+			return fmt.Errorf("unknown cluster claim %q, valid claims are %s", claim, strings.Join(ClusterClaimNames(), ", "))
+		}
+		if errs := validation.IsDNS1123Subdomain(prefix + claim); len(errs) > 0 {
+			return fmt.Errorf("invalid cluster claim name %q: %s", prefix+claim, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// syncClusterClaim creates ManagedClusterClaims in the SPOKE cluster for the
+// enabled claims of the catalog, and deletes the ones no longer published.
 // The klusterlet automatically syncs claims to the hub's ManagedCluster status.
 // This demonstrates how agents can expose cluster properties.
 func (o *AgentOptions) syncClusterClaim(ctx context.Context, spokeClient kubernetes.Interface, spokeDynamicClient dynamic.Interface) error {
-	klog.V(4).Info("Syncing cluster claim")
+	klog.V(4).Info("Syncing cluster claims")
 
+	desired, err := o.clusterClaimValues(ctx, spokeClient)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range desired {
+		if err := applyClusterClaim(ctx, spokeDynamicClient, name, value); err != nil {
+			return err
+		}
+	}
+
+	// Delete the claims of this agent that were turned off or no longer apply.
+	// They are found by label, so the claims published with a previous prefix
+	// are deleted too.
+	existing, err := spokeDynamicClient.Resource(claimGVR).List(ctx, metav1.ListOptions{LabelSelector: "app=basic-addon"})
+	if err != nil {
+		return fmt.Errorf("failed to list cluster claims: %w", err)
+	}
+	for _, claim := range existing.Items {
+		if _, ok := desired[claim.GetName()]; ok {
+			continue
+		}
+		err := spokeDynamicClient.Resource(claimGVR).Delete(ctx, claim.GetName(), metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete cluster claim %s: %w", claim.GetName(), err)
+		}
+		klog.Infof("Deleted ClusterClaim %s", claim.GetName())
+	}
+
+	return nil
+}
+
+// clusterClaimValues returns the value of each enabled claim that applies to
+// the cluster, by prefixed claim name.
+func (o *AgentOptions) clusterClaimValues(ctx context.Context, spokeClient kubernetes.Interface) (map[string]string, error) {
 	// Get Kubernetes version from spoke
 	serverVersion, err := spokeClient.Discovery().ServerVersion()
 	if err != nil {
-		return fmt.Errorf("failed to get server version: %w", err)
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+	nodeList, err := spokeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	input := &claimInput{serverVersion: serverVersion.GitVersion, nodes: nodeList.Items}
+
+	catalog := claimCatalog()
+	values := map[string]string{}
+	for _, claim := range o.ClusterClaims {
+		valueFunc, ok := catalog[claim]
+		if !ok {
+			return nil, fmt.Errorf("unknown cluster claim %q", claim)
+		}
+		value, err := valueFunc(ctx, spokeClient, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) == 0 {
+			continue
+		}
+		values[o.ClusterClaimPrefix+claim] = truncateClaimValue(value, maxClaimValueLength)
 	}
+	return values, nil
+}
 
+// applyClusterClaim creates the claim or updates its value.
+func applyClusterClaim(ctx context.Context, spokeDynamicClient dynamic.Interface, name, value string) error {
 	// Build ClusterClaim (applied to SPOKE, not hub!)
 	claim := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
 			"kind":       "ClusterClaim",
 			"metadata": map[string]interface{}{
-				"name": ClusterClaimName,
+				"name": name,
 				"labels": map[string]interface{}{
 					"app": "basic-addon",
 				},
 			},
 			"spec": map[string]interface{}{
-				"value": serverVersion.GitVersion,
+				"value": value,
 			},
 		},
 	}
 
 	// Check if exists
-	existing, err := spokeDynamicClient.Resource(claimGVR).Get(ctx, ClusterClaimName, metav1.GetOptions{})
-	if err == nil {
-		// Update existing
-		claim.SetResourceVersion(existing.GetResourceVersion())
-		_, err = spokeDynamicClient.Resource(claimGVR).Update(ctx, claim, metav1.UpdateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to update cluster claim: %w", err)
-		}
-		klog.Infof("Updated ClusterClaim %s: %s", ClusterClaimName, serverVersion.GitVersion)
-	} else {
-		// Create new
+	existing, err := spokeDynamicClient.Resource(claimGVR).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
 		_, err = spokeDynamicClient.Resource(claimGVR).Create(ctx, claim, metav1.CreateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to create cluster claim: %w", err)
+			return fmt.Errorf("failed to create cluster claim %s: %w", name, err)
 		}
-		klog.Infof("Created ClusterClaim %s: %s", ClusterClaimName, serverVersion.GitVersion)
+		klog.Infof("Created ClusterClaim %s: %s", name, value)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get cluster claim %s: %w", name, err)
 	}
 
+	if current, _, _ := unstructured.NestedString(existing.Object, "spec", "value"); current == value &&
+		existing.GetLabels()["app"] == "basic-addon" {
+		return nil
+	}
+	claim.SetResourceVersion(existing.GetResourceVersion())
+	_, err = spokeDynamicClient.Resource(claimGVR).Update(ctx, claim, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update cluster claim %s: %w", name, err)
+	}
+	klog.Infof("Updated ClusterClaim %s: %s", name, value)
 	return nil
 }
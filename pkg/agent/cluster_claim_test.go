@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/version"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterClaimValues(t *testing.T) {
+	node := func(name, arch, zone, providerID string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+				corev1.LabelTopologyRegion: "us-east-1",
+				corev1.LabelTopologyZone:   zone,
+			}},
+			Spec: corev1.NodeSpec{ProviderID: providerID},
+			Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+				Architecture:            arch,
+				OSImage:                 "Ubuntu 22.04.4 LTS",
+				ContainerRuntimeVersion: "containerd://1.7.13",
+			}},
+		}
+	}
+	objects := []runtime.Object{
+		node("node1", "amd64", "us-east-1a", "aws:///us-east-1a/i-1"),
+		node("node2", "arm64", "us-east-1b", "aws:///us-east-1b/i-2"),
+		node("node3", "amd64", "us-east-1a", "aws:///us-east-1a/i-3"),
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "calico-node", Namespace: "calico-system"}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "gp3",
+			Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}},
+	}
+
+	tests := []struct {
+		name       string
+		claims     []string
+		prefix     string
+		wantValues map[string]string
+	}{
+		{
+			name:       "default claim",
+			claims:     []string{ClaimK8sVersion},
+			prefix:     DefaultClusterClaimPrefix,
+			wantValues: map[string]string{ClusterClaimName: "v1.30.0"},
+		},
+		{
+			name:   "whole catalog",
+			claims: ClusterClaimNames(),
+			prefix: "fleet.",
+			wantValues: map[string]string{
+				"fleet.k8s-version":          "v1.30.0",
+				"fleet.node-count":           "3",
+				"fleet.architectures":        "amd64,arm64",
+				"fleet.os-images":            "Ubuntu 22.04.4 LTS",
+				"fleet.container-runtimes":   "containerd://1.7.13",
+				"fleet.cloud-provider":       "aws",
+				"fleet.regions":              "us-east-1",
+				"fleet.zones":                "us-east-1a,us-east-1b",
+				"fleet.cni":                  "calico",
+				"fleet.default-storageclass": "gp3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spokeClient := kubefake.NewSimpleClientset(objects...)
+			spokeClient.Discovery().(*discoveryfake.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.0"}
+
+			opts := NewAgentOptions("basic-addon")
+			opts.ClusterClaims = tt.claims
+			opts.ClusterClaimPrefix = tt.prefix
+			if err := validateClusterClaims(opts.ClusterClaimPrefix, opts.ClusterClaims); err != nil {
+				t.Fatalf("validateClusterClaims() error = %v", err)
+			}
+
+			values, err := opts.clusterClaimValues(context.TODO(), spokeClient)
+			if err != nil {
+				t.Fatalf("clusterClaimValues() error = %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("clusterClaimValues() = %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestValidateClusterClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		claims  []string
+		wantErr bool
+	}{
+		{name: "default", prefix: DefaultClusterClaimPrefix, claims: []string{ClaimK8sVersion}},
+		{name: "unknown claim", prefix: DefaultClusterClaimPrefix, claims: []string{"gpu-count"}, wantErr: true},
+		{name: "invalid prefix", prefix: "Basic_Addon/", claims: []string{ClaimCNI}, wantErr: true},
+		{name: "name too long", prefix: strings.Repeat("a", 250) + ".", claims: []string{ClaimCNI}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateClusterClaims(tt.prefix, tt.claims); (err != nil) != tt.wantErr {
+				t.Errorf("validateClusterClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJoinClaimValues(t *testing.T) {
+	if got := joinClaimValues(sets.New("b", "a", "b")); got != "a,b" {
+		t.Errorf("joinClaimValues() = %q, want a,b", got)
+	}
+
+	many := sets.New[string]()
+	for i := 0; i < 200; i++ {
+		many.Insert(fmt.Sprintf("ip-10-0-%03d-001.internal", i))
+	}
+	got := joinClaimValues(many)
+	if len(got) > maxClaimValueLength {
+		t.Errorf("joinClaimValues() is %d bytes, want at most %d", len(got), maxClaimValueLength)
+	}
+	if !strings.HasSuffix(got, ",...") {
+		t.Errorf("joinClaimValues() = %q, want a truncated list", got)
+	}
+}
+
+func TestSyncClusterClaim(t *testing.T) {
+	claim := func(name, value string, labels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
+			"kind":       "ClusterClaim",
+			"metadata":   map[string]interface{}{"name": name, "labels": labels},
+			"spec":       map[string]interface{}{"value": value},
+		}}
+	}
+	owned := map[string]interface{}{"app": "basic-addon"}
+
+	spokeClient := kubefake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	spokeClient.Discovery().(*discoveryfake.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.0"}
+	spokeDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{claimGVR: "ClusterClaimList"},
+		claim(ClusterClaimName, "v1.29.0", owned),
+		claim("basic-addon.cni", "calico", owned),
+		claim("old-prefix.kubernetes-version", "v1.29.0", owned),
+		claim("id.k8s.io", "cluster1", nil),
+	)
+
+	opts := NewAgentOptions("basic-addon")
+	opts.ClusterClaims = []string{ClaimK8sVersion, ClaimNodeCount}
+	if err := opts.syncClusterClaim(context.TODO(), spokeClient, spokeDynamicClient); err != nil {
+		t.Fatalf("syncClusterClaim() error = %v", err)
+	}
+
+	claims, err := spokeDynamicClient.Resource(claimGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, item := range claims.Items {
+		got[item.GetName()], _, _ = unstructured.NestedString(item.Object, "spec", "value")
+	}
+	want := map[string]string{
+		ClusterClaimName:         "v1.30.0",
+		"basic-addon.node-count": "1",
+		"id.k8s.io":              "cluster1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cluster claims = %v, want %v", got, want)
+	}
+}
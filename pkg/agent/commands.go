@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// CommandGVR is the resource of the AddonCommands operators create on the hub.
+var CommandGVR = schema.GroupVersionResource{
+	Group:    "basic-addon.open-cluster-management.io",
+	Version:  "v1alpha1",
+	Resource: "addoncommands",
+}
+
+const (
+	// DefaultCommandInterval is how often the agent looks for new commands.
+	DefaultCommandInterval = 10 * time.Second
+
+	// maxConcurrentCommands bounds the commands running at the same time, so a
+	// long collect-logs doesn't hold the others back.
+	maxConcurrentCommands = 4
+
+	defaultCommandTimeout = 30 * time.Second
+	maxCommandTimeout     = 5 * time.Minute
+	// maxCommandResultBytes keeps command results well below the object size limit.
+	maxCommandResultBytes = 32 << 10
+
+	defaultPodLogLines = 100
+	maxPodLogLines     = 1000
+)
+
+// Command actions the agent accepts. Anything else is rejected.
+const (
+	CommandRefreshReport    = "refresh-report"
+	CommandPodLogs          = "pod-logs"
+	CommandDescribeWorkload = "describe-workload"
+	CommandCollectLogs      = "collect-logs"
+)
+
+// Command phases.
+const (
+	CommandRunning   = "Running"
+	CommandSucceeded = "Succeeded"
+	CommandFailed    = "Failed"
+)
+
+// commandAction runs a command with its parameters and returns its result.
+type commandAction func(ctx context.Context, command *unstructured.Unstructured, params map[string]string) (string, error)
+
+// commandRunner runs commands in the background, at most maxConcurrentCommands at a time.
+type commandRunner struct {
+	actions map[string]commandAction
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+func newCommandRunner(actions map[string]commandAction, maxConcurrent int) *commandRunner {
+	return &commandRunner{
+		actions: actions,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// wait blocks until the commands started so far are done.
+func (r *commandRunner) wait() {
+	r.running.Wait()
+}
+
+// commandStatus is the payload buffered in the outbox to set a command status.
+type commandStatus struct {
+	Name   string                 `json:"name"`
+	Status map[string]interface{} `json:"status"`
+}
+
+// commandActions returns the whitelisted command actions.
+func (o *AgentOptions) commandActions(spokeClient kubernetes.Interface, outbox *outbox) map[string]commandAction {
+	return map[string]commandAction{
+		CommandRefreshReport: func(ctx context.Context, _ *unstructured.Unstructured, _ map[string]string) (string, error) {
+			if err := o.syncPodReport(ctx, spokeClient, outbox); err != nil {
+				return "", err
+			}
+			return "Pod report refreshed", nil
+		},
+		CommandPodLogs: func(ctx context.Context, _ *unstructured.Unstructured, params map[string]string) (string, error) {
+			return podLogs(ctx, spokeClient, params)
+		},
+		CommandDescribeWorkload: func(ctx context.Context, _ *unstructured.Unstructured, params map[string]string) (string, error) {
+			return describeWorkload(ctx, spokeClient, params)
+		},
+		CommandCollectLogs: func(ctx context.Context, command *unstructured.Unstructured, params map[string]string) (string, error) {
+			return o.collectLogs(ctx, spokeClient, outbox, command, params)
+		},
+	}
+}
+
+// syncCommands starts the AddonCommands created in the cluster namespace on the
+// hub that haven't run yet, and reports their result in their status. This
+// lets hub operators ask the agent for data on demand. Completed commands are
+// skipped by their phase until the hub deletes them.
+func (o *AgentOptions) syncCommands(ctx context.Context, hubDynamicClient dynamic.Interface,
+	runner *commandRunner, outbox *outbox) error {
+	klog.V(4).Info("Syncing commands")
+
+	commands, err := hubDynamicClient.Resource(CommandGVR).Namespace(o.SpokeClusterName).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list commands: %w", err)
+	}
+	// Oldest first
+	sort.Slice(commands.Items, func(i, j int) bool {
+		created, other := commands.Items[i].GetCreationTimestamp(), commands.Items[j].GetCreationTimestamp()
+		return created.Before(&other)
+	})
+
+	for i := range commands.Items {
+		command := &commands.Items[i]
+		phase, _, _ := unstructured.NestedString(command.Object, "status", "phase")
+		switch {
+		case len(phase) == 0:
+			select {
+			case runner.slots <- struct{}{}:
+			default:
+				klog.V(4).Infof("%d commands running, leaving the others for the next sync", cap(runner.slots))
+				return nil
+			}
+			if err := o.startCommand(ctx, hubDynamicClient, command); err != nil {
+				<-runner.slots
+				return err
+			}
+			runner.running.Add(1)
+			go func() {
+				defer runner.running.Done()
+				defer func() { <-runner.slots }()
+				o.runCommand(ctx, runner.actions, outbox, command)
+			}()
+		case phase == CommandRunning && o.commandInterrupted(command, outbox):
+			// The agent restarted while running the command
+			o.publishCommandResult(ctx, outbox, command.GetName(), CommandFailed,
+				"The agent restarted while running the command", "")
+		}
+	}
+	return nil
+}
+
+// startCommand marks the command as running before running it, so it never
+// runs twice even if the agent restarts.
+func (o *AgentOptions) startCommand(ctx context.Context, hubDynamicClient dynamic.Interface, command *unstructured.Unstructured) error {
+	running := command.DeepCopy()
+	running.Object["status"] = map[string]interface{}{
+		"phase":     CommandRunning,
+		"startTime": metav1.Now().Format(time.RFC3339),
+	}
+	if _, err := hubDynamicClient.Resource(CommandGVR).Namespace(o.SpokeClusterName).UpdateStatus(ctx, running, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to start command %s: %w", command.GetName(), err)
+	}
+	return nil
+}
+
+// runCommand runs a started command with its timeout and publishes its result.
+func (o *AgentOptions) runCommand(ctx context.Context, actions map[string]commandAction, outbox *outbox,
+	command *unstructured.Unstructured) {
+	action, _, _ := unstructured.NestedString(command.Object, "spec", "action")
+	params, _, _ := unstructured.NestedStringMap(command.Object, "spec", "parameters")
+	timeout := commandTimeout(command)
+
+	run, ok := actions[action]
+	if !ok {
+		klog.Warningf("Rejected command %s: action %q is not allowed", command.GetName(), action)
+		o.publishCommandResult(ctx, outbox, command.GetName(), CommandFailed,
+			fmt.Sprintf("Action %q is not allowed", action), "")
+		return
+	}
+	if namespace, ok := params["namespace"]; ok && !slices.Contains(o.CommandNamespaces, namespace) {
+		klog.Warningf("Rejected command %s: namespace %q is not allowed", command.GetName(), namespace)
+		o.publishCommandResult(ctx, outbox, command.GetName(), CommandFailed,
+			fmt.Sprintf("Namespace %q is not allowed", namespace), "")
+		return
+	}
+
+	klog.Infof("Running command %s: %s %v (timeout %s)", command.GetName(), action, params, timeout)
+	actionCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := run(actionCtx, command, params)
+	if err != nil {
+		klog.Infof("Command %s failed: %v", command.GetName(), err)
+		o.publishCommandResult(ctx, outbox, command.GetName(), CommandFailed, err.Error(), result)
+		return
+	}
+	o.publishCommandResult(ctx, outbox, command.GetName(), CommandSucceeded, "", result)
+}
+
+// commandInterrupted returns whether a running command was started by an agent
+// that is gone: it is past its timeout and its result isn't waiting in the outbox.
+func (o *AgentOptions) commandInterrupted(command *unstructured.Unstructured, outbox *outbox) bool {
+	if _, pending := outbox.pendingPayload(strategyCommands, command.GetName()); pending {
+		return false
+	}
+	startTime, _, _ := unstructured.NestedString(command.Object, "status", "startTime")
+	started, err := time.Parse(time.RFC3339, startTime)
+	return err != nil || time.Since(started) > commandTimeout(command)+o.strategyInterval(strategyCommands)
+}
+
+// publishCommandResult sets the final status of the command through the outbox.
+func (o *AgentOptions) publishCommandResult(ctx context.Context, outbox *outbox, name, phase, message, result string) {
+	if len(result) > maxCommandResultBytes {
+		result = result[:maxCommandResultBytes]
+		message = strings.TrimSpace(message + " (result truncated)")
+	}
+	status := map[string]interface{}{
+		"phase":          phase,
+		"completionTime": metav1.Now().Format(time.RFC3339),
+	}
+	if len(message) > 0 {
+		status["message"] = message
+	}
+	if len(result) > 0 {
+		status["result"] = result
+	}
+
+	payload, err := json.Marshal(commandStatus{Name: name, Status: status})
+	if err != nil {
+		klog.Errorf("Failed to encode result of command %s: %v", name, err)
+		return
+	}
+	if err := outbox.publish(ctx, strategyCommands, name, payload); err != nil {
+		klog.Errorf("Failed to publish result of command %s, will retry: %v", name, err)
+	}
+}
+
+// publishCommandStatus sets the status in the payload on the AddonCommand, keeping its startTime.
+func (o *AgentOptions) publishCommandStatus(ctx context.Context, hubDynamicClient dynamic.Interface, payload []byte) error {
+	update := commandStatus{}
+	if err := utiljson.Unmarshal(payload, &update); err != nil {
+		return fmt.Errorf("failed to decode command status: %w", err)
+	}
+
+	commands := hubDynamicClient.Resource(CommandGVR).Namespace(o.SpokeClusterName)
+	command, err := commands.Get(ctx, update.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// Deleted by the operator, nothing to report to
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get command %s: %w", update.Name, err)
+	}
+
+	if startTime, found, _ := unstructured.NestedString(command.Object, "status", "startTime"); found {
+		update.Status["startTime"] = startTime
+	}
+	command.Object["status"] = update.Status
+	if _, err := commands.UpdateStatus(ctx, command, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update command %s status: %w", update.Name, err)
+	}
+	klog.Infof("Command %s %s", update.Name, update.Status["phase"])
+	return nil
+}
+
+// commandTimeout returns the timeout of the command, bounded to maxCommandTimeout.
+func commandTimeout(command *unstructured.Unstructured) time.Duration {
+	seconds, found, _ := unstructured.NestedInt64(command.Object, "spec", "timeoutSeconds")
+	if !found || seconds <= 0 {
+		return defaultCommandTimeout
+	}
+	return min(time.Duration(seconds)*time.Second, maxCommandTimeout)
+}
+
+// podLogs returns the last lines of the logs of a pod container.
+// Parameters: namespace, pod, container (optional) and tailLines (optional).
+func podLogs(ctx context.Context, spokeClient kubernetes.Interface, params map[string]string) (string, error) {
+	namespace, pod := params["namespace"], params["pod"]
+	if len(namespace) == 0 || len(pod) == 0 {
+		return "", fmt.Errorf("parameters namespace and pod are required")
+	}
+	tailLines, err := parseTailLines(params)
+	if err != nil {
+		return "", err
+	}
+
+	limitBytes := int64(maxCommandResultBytes)
+	logs, err := spokeClient.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container:  params["container"],
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs of pod %s/%s: %w", namespace, pod, err)
+	}
+	return string(logs), nil
+}
+
+// parseTailLines returns the tailLines parameter, bounded to maxPodLogLines.
+func parseTailLines(params map[string]string) (int64, error) {
+	value, ok := params["tailLines"]
+	if !ok {
+		return defaultPodLogLines, nil
+	}
+	lines, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || lines <= 0 {
+		return 0, fmt.Errorf("invalid tailLines %q", value)
+	}
+	return min(lines, maxPodLogLines), nil
+}
+
+// workloadDescription summarizes a workload and its recent events.
+type workloadDescription struct {
+	Kind          string            `json:"kind"`
+	Namespace     string            `json:"namespace"`
+	Name          string            `json:"name"`
+	Replicas      int32             `json:"replicas"`
+	ReadyReplicas int32             `json:"readyReplicas"`
+	Images        []string          `json:"images"`
+	Conditions    []string          `json:"conditions,omitempty"`
+	Events        []string          `json:"events,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// describeWorkload returns a JSON summary of a Deployment, StatefulSet or DaemonSet.
+// Parameters: namespace, kind and name.
+func describeWorkload(ctx context.Context, spokeClient kubernetes.Interface, params map[string]string) (string, error) {
+	namespace, kind, name := params["namespace"], strings.ToLower(params["kind"]), params["name"]
+	if len(namespace) == 0 || len(kind) == 0 || len(name) == 0 {
+		return "", fmt.Errorf("parameters namespace, kind and name are required")
+	}
+
+	description := workloadDescription{Namespace: namespace, Name: name}
+	var podSpec corev1.PodSpec
+	switch kind {
+	case "deployment":
+		deployment, err := spokeClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		description.Kind = "Deployment"
+		description.Labels = deployment.Labels
+		if deployment.Spec.Replicas != nil {
+			description.Replicas = *deployment.Spec.Replicas
+		}
+		description.ReadyReplicas = deployment.Status.ReadyReplicas
+		for _, condition := range deployment.Status.Conditions {
+			description.Conditions = append(description.Conditions,
+				fmt.Sprintf("%s=%s: %s", condition.Type, condition.Status, condition.Message))
+		}
+		podSpec = deployment.Spec.Template.Spec
+	case "statefulset":
+		statefulSet, err := spokeClient.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		description.Kind = "StatefulSet"
+		description.Labels = statefulSet.Labels
+		if statefulSet.Spec.Replicas != nil {
+			description.Replicas = *statefulSet.Spec.Replicas
+		}
+		description.ReadyReplicas = statefulSet.Status.ReadyReplicas
+		for _, condition := range statefulSet.Status.Conditions {
+			description.Conditions = append(description.Conditions,
+				fmt.Sprintf("%s=%s: %s", condition.Type, condition.Status, condition.Message))
+		}
+		podSpec = statefulSet.Spec.Template.Spec
+	case "daemonset":
+		daemonSet, err := spokeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		description.Kind = "DaemonSet"
+		description.Labels = daemonSet.Labels
+		description.Replicas = daemonSet.Status.DesiredNumberScheduled
+		description.ReadyReplicas = daemonSet.Status.NumberReady
+		for _, condition := range daemonSet.Status.Conditions {
+			description.Conditions = append(description.Conditions,
+				fmt.Sprintf("%s=%s: %s", condition.Type, condition.Status, condition.Message))
+		}
+		podSpec = daemonSet.Spec.Template.Spec
+	default:
+		return "", fmt.Errorf("unsupported kind %q, expected deployment, statefulset or daemonset", params["kind"])
+	}
+
+	for _, container := range podSpec.Containers {
+		description.Images = append(description.Images, container.Image)
+	}
+
+	events, err := spokeClient.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("involvedObject.name", name),
+			fields.OneTermEqualSelector("involvedObject.kind", description.Kind),
+		).String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list events: %w", err)
+	}
+	for _, event := range events.Items {
+		description.Events = append(description.Events,
+			fmt.Sprintf("%s %s: %s (x%d)", event.Type, event.Reason, event.Message, max(event.Count, 1)))
+	}
+
+	data, err := json.MarshalIndent(description, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
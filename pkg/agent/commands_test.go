@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestCommand(name, action string, params map[string]interface{}, status map[string]interface{}, age time.Duration) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "basic-addon.open-cluster-management.io/v1alpha1",
+		"kind":       "AddonCommand",
+		"metadata": map[string]interface{}{
+			"name":              name,
+			"namespace":         "cluster1",
+			"creationTimestamp": time.Now().Add(-age).UTC().Format(time.RFC3339),
+		},
+		"spec": map[string]interface{}{"action": action, "parameters": params},
+	}}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func TestSyncCommands(t *testing.T) {
+	command := newTestCommand
+	replicas := int32(2)
+	spokeClient := kubefake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "web", Image: "nginx:1.27"}},
+				}},
+			},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+	)
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{CommandGVR: "AddonCommandList"},
+		command("logs", CommandPodLogs, map[string]interface{}{"namespace": "default", "pod": "web-1", "tailLines": "10"}, nil, time.Minute),
+		command("describe", CommandDescribeWorkload, map[string]interface{}{"namespace": "default", "kind": "Deployment", "name": "web"}, nil, time.Minute),
+		command("other-namespace", CommandPodLogs, map[string]interface{}{"namespace": "kube-system", "pod": "etcd"}, nil, time.Minute),
+		command("missing-params", CommandPodLogs, nil, nil, time.Minute),
+		command("not-allowed", "exec", nil, nil, time.Minute),
+		command("done", CommandPodLogs, nil, map[string]interface{}{"phase": CommandSucceeded, "result": "old"}, time.Hour),
+		command("interrupted", CommandPodLogs, nil, map[string]interface{}{
+			"phase":     CommandRunning,
+			"startTime": time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		}, time.Hour),
+	)
+
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	opts.CommandNamespaces = []string{"default"}
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyCommands, func(ctx context.Context, payload []byte) error {
+		return opts.publishCommandStatus(ctx, hubDynamicClient, payload)
+	})
+
+	// More new commands than slots: the others start on the next sync
+	runner := newCommandRunner(opts.commandActions(spokeClient, b), maxConcurrentCommands)
+	for i := 0; i < 2; i++ {
+		if err := opts.syncCommands(context.TODO(), hubDynamicClient, runner, b); err != nil {
+			t.Fatalf("syncCommands() error = %v", err)
+		}
+		runner.wait()
+	}
+
+	tests := []struct {
+		name          string
+		wantPhase     string
+		wantResult    string
+		wantMessage   string
+		wantStartTime bool
+		wantCompleted bool
+	}{
+		{name: "logs", wantPhase: CommandSucceeded, wantResult: "fake logs", wantStartTime: true, wantCompleted: true},
+		{name: "describe", wantPhase: CommandSucceeded, wantResult: `"images": [`, wantStartTime: true, wantCompleted: true},
+		{name: "other-namespace", wantPhase: CommandFailed, wantMessage: `Namespace "kube-system" is not allowed`, wantStartTime: true, wantCompleted: true},
+		{name: "missing-params", wantPhase: CommandFailed, wantMessage: "parameters namespace and pod are required", wantStartTime: true, wantCompleted: true},
+		{name: "not-allowed", wantPhase: CommandFailed, wantMessage: `Action "exec" is not allowed`, wantStartTime: true, wantCompleted: true},
+		{name: "done", wantPhase: CommandSucceeded, wantResult: "old"},
+		{name: "interrupted", wantPhase: CommandFailed, wantMessage: "restarted", wantStartTime: true, wantCompleted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := hubDynamicClient.Resource(CommandGVR).Namespace("cluster1").Get(context.TODO(), tt.name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+			result, _, _ := unstructured.NestedString(obj.Object, "status", "result")
+			message, _, _ := unstructured.NestedString(obj.Object, "status", "message")
+			_, hasStartTime, _ := unstructured.NestedString(obj.Object, "status", "startTime")
+			if phase != tt.wantPhase {
+				t.Errorf("phase = %q, want %q (message %q)", phase, tt.wantPhase, message)
+			}
+			if !strings.Contains(result, tt.wantResult) {
+				t.Errorf("result = %q, want it to contain %q", result, tt.wantResult)
+			}
+			if !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("message = %q, want it to contain %q", message, tt.wantMessage)
+			}
+			if hasStartTime != tt.wantStartTime {
+				t.Errorf("startTime set = %v, want %v", hasStartTime, tt.wantStartTime)
+			}
+			if _, completed, _ := unstructured.NestedString(obj.Object, "status", "completionTime"); completed != tt.wantCompleted {
+				t.Errorf("completionTime set = %v, want %v", completed, tt.wantCompleted)
+			}
+		})
+	}
+}
+
+func TestSyncCommandsConcurrently(t *testing.T) {
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{CommandGVR: "AddonCommandList"},
+		newTestCommand("slow", "slow", nil, nil, 3*time.Minute),
+		newTestCommand("fast", "fast", nil, nil, 2*time.Minute),
+		newTestCommand("later", "fast", nil, nil, time.Minute),
+	)
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyCommands, func(ctx context.Context, payload []byte) error {
+		return opts.publishCommandStatus(ctx, hubDynamicClient, payload)
+	})
+
+	release := make(chan struct{})
+	runner := newCommandRunner(map[string]commandAction{
+		"slow": func(ctx context.Context, _ *unstructured.Unstructured, _ map[string]string) (string, error) {
+			<-release
+			return "slow", nil
+		},
+		"fast": func(ctx context.Context, _ *unstructured.Unstructured, _ map[string]string) (string, error) {
+			return "fast", nil
+		},
+	}, 2)
+	phase := func(name string) string {
+		obj, err := hubDynamicClient.Resource(CommandGVR).Namespace("cluster1").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return phase
+	}
+
+	if err := opts.syncCommands(context.TODO(), hubDynamicClient, runner, b); err != nil {
+		t.Fatalf("syncCommands() error = %v", err)
+	}
+	// The slow command doesn't hold the fast one back
+	err = wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return phase("fast") == CommandSucceeded, nil
+	})
+	if err != nil {
+		t.Fatalf("fast command didn't complete while the slow one runs: phase %q", phase("fast"))
+	}
+	if got := phase("slow"); got != CommandRunning {
+		t.Errorf("slow command phase = %q, want %q", got, CommandRunning)
+	}
+	// Both slots were taken: the last command waits for the next sync
+	if got := phase("later"); len(got) != 0 {
+		t.Errorf("later command phase = %q, want it not started", got)
+	}
+
+	close(release)
+	runner.wait()
+	if err := opts.syncCommands(context.TODO(), hubDynamicClient, runner, b); err != nil {
+		t.Fatalf("syncCommands() error = %v", err)
+	}
+	runner.wait()
+	for _, name := range []string{"slow", "later"} {
+		if got := phase(name); got != CommandSucceeded {
+			t.Errorf("%s command phase = %q, want %q", name, got, CommandSucceeded)
+		}
+	}
+}
+
+func TestSyncCommandsWithoutNamespaces(t *testing.T) {
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{CommandGVR: "AddonCommandList"},
+		newTestCommand("logs", CommandPodLogs, map[string]interface{}{"namespace": "default", "pod": "web-1"}, nil, time.Minute),
+	)
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyCommands, func(ctx context.Context, payload []byte) error {
+		return opts.publishCommandStatus(ctx, hubDynamicClient, payload)
+	})
+
+	// No namespace is allowed unless --command-namespaces lists it
+	runner := newCommandRunner(opts.commandActions(kubefake.NewSimpleClientset(), b), maxConcurrentCommands)
+	if err := opts.syncCommands(context.TODO(), hubDynamicClient, runner, b); err != nil {
+		t.Fatalf("syncCommands() error = %v", err)
+	}
+	runner.wait()
+
+	obj, err := hubDynamicClient.Resource(CommandGVR).Namespace("cluster1").Get(context.TODO(), "logs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(obj.Object, "status", "message")
+	if phase != CommandFailed || !strings.Contains(message, `Namespace "default" is not allowed`) {
+		t.Errorf("phase = %q, message = %q, want the namespace rejected", phase, message)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	tests := []struct {
+		timeoutSeconds interface{}
+		want           time.Duration
+	}{
+		{timeoutSeconds: nil, want: defaultCommandTimeout},
+		{timeoutSeconds: int64(5), want: 5 * time.Second},
+		{timeoutSeconds: int64(3600), want: maxCommandTimeout},
+	}
+	for _, tt := range tests {
+		spec := map[string]interface{}{"action": CommandPodLogs}
+		if tt.timeoutSeconds != nil {
+			spec["timeoutSeconds"] = tt.timeoutSeconds
+		}
+		command := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		if got := commandTimeout(command); got != tt.want {
+			t.Errorf("commandTimeout(%v) = %s, want %s", tt.timeoutSeconds, got, tt.want)
+		}
+	}
+}
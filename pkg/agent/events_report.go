@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventsReportConfigMapName is the ConfigMap with the Warning events of the spoke.
+	EventsReportConfigMapName = "events-report"
+
+	// maxEventsReportEntries keeps the report well below the ConfigMap size limit.
+	// The most recently seen entries are kept.
+	maxEventsReportEntries = 500
+)
+
+// DefaultEventReasons are the Warning event reasons reported by default.
+var DefaultEventReasons = []string{"FailedScheduling", "BackOff", "FailedMount", "OOMKilling"}
+
+// EventsReport is the structure sent to the hub with the Warning events of the
+// spoke, deduplicated by involved object and reason.
+type EventsReport struct {
+	ClusterName string    `json:"clusterName"`
+	Timestamp   time.Time `json:"timestamp"`
+	// TotalEvents is the number of occurrences of all reported events.
+	TotalEvents int32 `json:"totalEvents"`
+	// Truncated is set when older entries were left out of the report.
+	Truncated bool         `json:"truncated,omitempty"`
+	Events    []EventEntry `json:"events"`
+}
+
+// EventEntry aggregates the Warning events with the same involved object and reason.
+type EventEntry struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// syncEventsReport collects the Warning events of the spoke and sends the events report to the hub.
+func (o *AgentOptions) syncEventsReport(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox) error {
+	klog.V(4).Info("Syncing events report")
+
+	events, err := spokeClient.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	report := buildEventsReport(o.SpokeClusterName, events.Items, o.EventReasons)
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyEventsReport, EventsReportConfigMapName, reportJSON)
+}
+
+// publishEventsReport creates or updates the events report ConfigMap in hub.
+func (o *AgentOptions) publishEventsReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, EventsReportConfigMapName, reportJSON)
+}
+
+// buildEventsReport aggregates the Warning events with one of the reasons by
+// involved object and reason. All Warning events are reported when reasons is empty.
+func buildEventsReport(clusterName string, events []corev1.Event, reasons []string) EventsReport {
+	allowed := sets.New(reasons...)
+	entries := map[string]*EventEntry{}
+	var total int32
+
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning || (allowed.Len() > 0 && !allowed.Has(event.Reason)) {
+			continue
+		}
+		count := eventCount(event)
+		first, last := eventTimes(event)
+		total += count
+
+		key := fmt.Sprintf("%s/%s/%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Namespace,
+			event.InvolvedObject.Name, event.Reason)
+		entry, ok := entries[key]
+		if !ok {
+			entries[key] = &EventEntry{
+				Kind:      event.InvolvedObject.Kind,
+				Namespace: event.InvolvedObject.Namespace,
+				Name:      event.InvolvedObject.Name,
+				Reason:    event.Reason,
+				Message:   event.Message,
+				Count:     count,
+				FirstSeen: first,
+				LastSeen:  last,
+			}
+			continue
+		}
+		entry.Count += count
+		if first.Before(entry.FirstSeen) {
+			entry.FirstSeen = first
+		}
+		if last.After(entry.LastSeen) {
+			entry.LastSeen = last
+			entry.Message = event.Message
+		}
+	}
+
+	report := EventsReport{
+		ClusterName: clusterName,
+		Timestamp:   time.Now().UTC(),
+		TotalEvents: total,
+		Events:      make([]EventEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		report.Events = append(report.Events, *entry)
+	}
+	// Most recent first, then by object for a stable report
+	sort.Slice(report.Events, func(i, j int) bool {
+		a, b := report.Events[i], report.Events[j]
+		if !a.LastSeen.Equal(b.LastSeen) {
+			return a.LastSeen.After(b.LastSeen)
+		}
+		return fmt.Sprint(a.Kind, a.Namespace, a.Name, a.Reason) < fmt.Sprint(b.Kind, b.Namespace, b.Name, b.Reason)
+	})
+	if len(report.Events) > maxEventsReportEntries {
+		report.Events = report.Events[:maxEventsReportEntries]
+		report.Truncated = true
+	}
+	return report
+}
+
+// eventCount returns the number of occurrences of an event, from either the
+// core/v1 count or the events.k8s.io/v1 series.
+func eventCount(event corev1.Event) int32 {
+	if event.Series != nil && event.Series.Count > 0 {
+		return event.Series.Count
+	}
+	return max(event.Count, 1)
+}
+
+// eventTimes returns when an event was first and last seen, falling back to
+// the fields set by events.k8s.io/v1 clients.
+func eventTimes(event corev1.Event) (time.Time, time.Time) {
+	first := event.FirstTimestamp.Time
+	if first.IsZero() {
+		first = event.EventTime.Time
+	}
+	if first.IsZero() {
+		first = event.CreationTimestamp.Time
+	}
+
+	last := event.LastTimestamp.Time
+	if event.Series != nil && event.Series.LastObservedTime.After(last) {
+		last = event.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	return first.UTC(), last.UTC()
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildEventsReport(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	event := func(kind, namespace, name, reason, eventType string, count int32, first, last time.Duration) corev1.Event {
+		return corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%s.%d", name, reason, count), Namespace: namespace},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Namespace: namespace, Name: name},
+			Reason:         reason,
+			Message:        fmt.Sprintf("%s %d", reason, count),
+			Type:           eventType,
+			Count:          count,
+			FirstTimestamp: metav1.NewTime(now.Add(-first)),
+			LastTimestamp:  metav1.NewTime(now.Add(-last)),
+		}
+	}
+	seriesEvent := corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web-2.failedmount", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-2"},
+		Reason:         "FailedMount",
+		Message:        "MountVolume.SetUp failed",
+		Type:           corev1.EventTypeWarning,
+		EventTime:      metav1.NewMicroTime(now.Add(-time.Hour)),
+		Series:         &corev1.EventSeries{Count: 7, LastObservedTime: metav1.NewMicroTime(now.Add(-time.Minute))},
+	}
+
+	events := []corev1.Event{
+		event("Pod", "default", "web-1", "BackOff", corev1.EventTypeWarning, 3, 30*time.Minute, 10*time.Minute),
+		event("Pod", "default", "web-1", "BackOff", corev1.EventTypeWarning, 2, time.Hour, 2*time.Minute),
+		event("Pod", "default", "web-1", "FailedScheduling", corev1.EventTypeWarning, 1, 5*time.Minute, 5*time.Minute),
+		event("Pod", "default", "web-1", "Pulled", corev1.EventTypeNormal, 4, time.Minute, time.Minute),
+		event("Pod", "default", "web-1", "Unhealthy", corev1.EventTypeWarning, 9, time.Minute, time.Minute),
+		event("Node", "", "node1", "OOMKilling", corev1.EventTypeWarning, 1, 20*time.Minute, 20*time.Minute),
+		seriesEvent,
+	}
+
+	tests := []struct {
+		name        string
+		reasons     []string
+		wantEntries []EventEntry
+		wantTotal   int32
+	}{
+		{
+			name:    "default reasons",
+			reasons: DefaultEventReasons,
+			wantEntries: []EventEntry{
+				{Kind: "Pod", Namespace: "default", Name: "web-2", Reason: "FailedMount", Message: "MountVolume.SetUp failed",
+					Count: 7, FirstSeen: now.Add(-time.Hour), LastSeen: now.Add(-time.Minute)},
+				{Kind: "Pod", Namespace: "default", Name: "web-1", Reason: "BackOff", Message: "BackOff 2",
+					Count: 5, FirstSeen: now.Add(-time.Hour), LastSeen: now.Add(-2 * time.Minute)},
+				{Kind: "Pod", Namespace: "default", Name: "web-1", Reason: "FailedScheduling", Message: "FailedScheduling 1",
+					Count: 1, FirstSeen: now.Add(-5 * time.Minute), LastSeen: now.Add(-5 * time.Minute)},
+				{Kind: "Node", Name: "node1", Reason: "OOMKilling", Message: "OOMKilling 1",
+					Count: 1, FirstSeen: now.Add(-20 * time.Minute), LastSeen: now.Add(-20 * time.Minute)},
+			},
+			wantTotal: 14,
+		},
+		{
+			name:    "selected reasons",
+			reasons: []string{"Unhealthy"},
+			wantEntries: []EventEntry{
+				{Kind: "Pod", Namespace: "default", Name: "web-1", Reason: "Unhealthy", Message: "Unhealthy 9",
+					Count: 9, FirstSeen: now.Add(-time.Minute), LastSeen: now.Add(-time.Minute)},
+			},
+			wantTotal: 9,
+		},
+		{
+			name:      "all warnings",
+			wantTotal: 23,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := buildEventsReport("cluster1", events, tt.reasons)
+			if report.TotalEvents != tt.wantTotal {
+				t.Errorf("TotalEvents = %d, want %d", report.TotalEvents, tt.wantTotal)
+			}
+			if tt.wantEntries != nil && !reflect.DeepEqual(report.Events, tt.wantEntries) {
+				t.Errorf("Events = %+v, want %+v", report.Events, tt.wantEntries)
+			}
+			for _, entry := range report.Events {
+				if entry.Reason == "Pulled" {
+					t.Errorf("Normal event %v was reported", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncEventsReport(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web-1.backoff", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1"},
+		Reason:         "BackOff",
+		Type:           corev1.EventTypeWarning,
+		Count:          2,
+	})
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyEventsReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishEventsReport(ctx, hubClient, payload)
+	})
+
+	// Twice, to create and then update the report
+	for i := 0; i < 2; i++ {
+		if err := opts.syncEventsReport(context.TODO(), spokeClient, b); err != nil {
+			t.Fatalf("syncEventsReport() error = %v", err)
+		}
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), EventsReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("events report was not published: %v", err)
+	}
+	report := EventsReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.ClusterName != "cluster1" || report.TotalEvents != 2 || len(report.Events) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
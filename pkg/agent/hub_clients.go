@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// hubReloadDelay groups the burst of file events a secret volume update produces
+// into a single reload.
+const hubReloadDelay = 2 * time.Second
+
+// hubClients holds the hub clients built from the hub kubeconfig and rebuilds
+// them when the kubeconfig or the certificate files it references change, so
+// rotated credentials are picked up without restarting the agent.
+type hubClients struct {
+	kubeconfigFile string
+
+	lock          sync.RWMutex
+	httpClient    *http.Client
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	watchedFiles  []string
+}
+
+// newHubClients builds the hub clients from the kubeconfig file.
+func newHubClients(kubeconfigFile string) (*hubClients, error) {
+	h := &hubClients{kubeconfigFile: kubeconfigFile}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// load (re)builds the hub clients. The current clients are kept on error.
+// Both clients share one transport, whose idle connections are closed once it
+// is replaced, so reloads don't leak connections with the old credentials.
+func (h *hubClients) load() error {
+	hubRestConfig, err := clientcmd.BuildConfigFromFlags("", h.kubeconfigFile)
+	if err != nil {
+		return err
+	}
+	httpClient, err := rest.HTTPClientFor(hubRestConfig)
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubernetes.NewForConfigAndClient(hubRestConfig, httpClient)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfigAndClient(hubRestConfig, httpClient)
+	if err != nil {
+		return err
+	}
+
+	files := []string{h.kubeconfigFile}
+	for _, file := range []string{
+		hubRestConfig.TLSClientConfig.CertFile,
+		hubRestConfig.TLSClientConfig.KeyFile,
+		hubRestConfig.TLSClientConfig.CAFile,
+	} {
+		if len(file) > 0 {
+			files = append(files, file)
+		}
+	}
+
+	h.lock.Lock()
+	oldHTTPClient := h.httpClient
+	h.httpClient = httpClient
+	h.kubeClient = kubeClient
+	h.dynamicClient = dynamicClient
+	h.watchedFiles = files
+	h.lock.Unlock()
+
+	// Requests in flight on the old transport finish, its idle connections are closed
+	if oldHTTPClient != nil && oldHTTPClient.Transport != httpClient.Transport {
+		utilnet.CloseIdleConnectionsFor(oldHTTPClient.Transport)
+	}
+	return nil
+}
+
+// clients returns the current hub clients.
+func (h *hubClients) clients() (kubernetes.Interface, dynamic.Interface) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.kubeClient, h.dynamicClient
+}
+
+// watchDirs returns the directories containing the kubeconfig and certificate files.
+// Directories are watched instead of files because secret volumes are updated
+// by swapping a symlink, which doesn't emit events on the files themselves.
+func (h *hubClients) watchDirs() []string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	dirs := sets.New[string]()
+	for _, file := range h.watchedFiles {
+		dirs.Insert(filepath.Dir(file))
+	}
+	return sets.List(dirs)
+}
+
+// watch reloads the hub clients whenever the watched files change, until the
+// context is done.
+func (h *hubClients) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range h.watchDirs() {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	reload := time.NewTimer(hubReloadDelay)
+	reload.Stop()
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			klog.V(4).Infof("Hub kubeconfig watcher event: %s", event)
+			reload.Reset(hubReloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			klog.Errorf("Hub kubeconfig watcher error: %v", err)
+		case <-reload.C:
+			if err := h.load(); err != nil {
+				klog.Errorf("Failed to reload hub kubeconfig, keeping current clients: %v", err)
+				continue
+			}
+			klog.Info("Reloaded hub clients after kubeconfig change")
+			// Certificate files may have moved to another directory
+			for _, dir := range h.watchDirs() {
+				if err := watcher.Add(dir); err != nil {
+					klog.Errorf("Failed to watch %s: %v", dir, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestHubClientsReloadOnKubeconfigChange(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfigFile := filepath.Join(dir, "kubeconfig")
+	writeKubeconfig(t, kubeconfigFile, "https://hub-1:6443")
+
+	hubClients, err := newHubClients(kubeconfigFile)
+	if err != nil {
+		t.Fatalf("newHubClients() error = %v", err)
+	}
+	oldClient, _ := hubClients.clients()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := hubClients.watch(ctx); err != nil {
+			t.Errorf("watch() error = %v", err)
+		}
+	}()
+
+	// Give the watcher time to start before rotating the kubeconfig
+	time.Sleep(200 * time.Millisecond)
+	writeKubeconfig(t, kubeconfigFile, "https://hub-2:6443")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if newClient, _ := hubClients.clients(); newClient != oldClient {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("hub clients were not rebuilt after the kubeconfig changed")
+}
+
+func TestNewHubClientsMissingKubeconfig(t *testing.T) {
+	if _, err := newHubClients(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing kubeconfig")
+	}
+}
+
+func writeKubeconfig(t *testing.T, path, server string) {
+	t.Helper()
+	config := clientcmdapi.NewConfig()
+	config.Clusters["hub"] = &clientcmdapi.Cluster{Server: server}
+	config.AuthInfos["agent"] = &clientcmdapi.AuthInfo{Token: "token"}
+	config.Contexts["hub"] = &clientcmdapi.Context{Cluster: "hub", AuthInfo: "agent"}
+	config.CurrentContext = "hub"
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+}
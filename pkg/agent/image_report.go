@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ImageReportConfigMapName is the ConfigMap with the container images running on the spoke.
+	ImageReportConfigMapName = "image-report"
+
+	// maxImageReportEntries and maxImageWorkloads keep the report below the
+	// ConfigMap size limit. Images and workloads over the limits are counted
+	// but left out of the report.
+	maxImageReportEntries = 1000
+	maxImageWorkloads     = 100
+)
+
+// ImageReport is the structure sent to the hub with the container images
+// running on the spoke, deduplicated by image and digest.
+type ImageReport struct {
+	ClusterName string    `json:"clusterName"`
+	Timestamp   time.Time `json:"timestamp"`
+	TotalImages int       `json:"totalImages"`
+	// Truncated is set when images were left out of the report.
+	Truncated bool        `json:"truncated,omitempty"`
+	Images    []ImageInfo `json:"images"`
+}
+
+// ImageInfo is a container image and the workloads running it.
+type ImageInfo struct {
+	Image string `json:"image"`
+	// Digest is the sha256 digest of the image the container runtime pulled,
+	// from the imageID of the container status.
+	Digest     string   `json:"digest,omitempty"`
+	Namespaces []string `json:"namespaces"`
+	// Workloads are "Kind/namespace/name". Bare pods are reported as Pods.
+	Workloads      []string `json:"workloads"`
+	TotalWorkloads int      `json:"totalWorkloads"`
+}
+
+// syncImageReport collects the images of the running containers and sends the image report to the hub.
+func (o *AgentOptions) syncImageReport(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox) error {
+	klog.V(4).Info("Syncing image report")
+
+	pods, err := spokeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	report := buildImageReport(o.SpokeClusterName, pods.Items)
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyImageReport, ImageReportConfigMapName, reportJSON)
+}
+
+// publishImageReport creates or updates the image report ConfigMap in hub.
+func (o *AgentOptions) publishImageReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, ImageReportConfigMapName, reportJSON)
+}
+
+// buildImageReport creates an ImageReport from the container statuses of the
+// pods. Containers that haven't pulled their image yet are left out.
+func buildImageReport(clusterName string, pods []corev1.Pod) ImageReport {
+	type imageKey struct {
+		image, digest string
+	}
+	type imageUsage struct {
+		namespaces sets.Set[string]
+		workloads  sets.Set[string]
+	}
+	usages := map[imageKey]*imageUsage{}
+
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		workload := podWorkload(&pod)
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if len(status.ImageID) == 0 {
+				continue
+			}
+			key := imageKey{image: status.Image, digest: imageDigest(status.ImageID)}
+			usage, ok := usages[key]
+			if !ok {
+				usage = &imageUsage{namespaces: sets.New[string](), workloads: sets.New[string]()}
+				usages[key] = usage
+			}
+			usage.namespaces.Insert(pod.Namespace)
+			usage.workloads.Insert(workload)
+		}
+	}
+
+	report := ImageReport{
+		ClusterName: clusterName,
+		Timestamp:   time.Now().UTC(),
+		TotalImages: len(usages),
+		Images:      make([]ImageInfo, 0, len(usages)),
+	}
+	for key, usage := range usages {
+		workloads := sets.List(usage.workloads)
+		report.Images = append(report.Images, ImageInfo{
+			Image:          key.image,
+			Digest:         key.digest,
+			Namespaces:     sets.List(usage.namespaces),
+			Workloads:      workloads[:min(len(workloads), maxImageWorkloads)],
+			TotalWorkloads: len(workloads),
+		})
+	}
+	sort.Slice(report.Images, func(i, j int) bool {
+		if report.Images[i].Image != report.Images[j].Image {
+			return report.Images[i].Image < report.Images[j].Image
+		}
+		return report.Images[i].Digest < report.Images[j].Digest
+	})
+	if len(report.Images) > maxImageReportEntries {
+		report.Images = report.Images[:maxImageReportEntries]
+		report.Truncated = true
+	}
+	return report
+}
+
+// imageDigest returns the digest of a container status imageID, which container
+// runtimes report as "docker-pullable://repo@sha256:...", "repo@sha256:..." or "sha256:...".
+func imageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	if strings.HasPrefix(imageID, "sha256:") {
+		return imageID
+	}
+	return ""
+}
+
+// podWorkload returns the workload of a pod as "Kind/namespace/name". Pods of
+// a ReplicaSet created by a Deployment are reported as the Deployment, using
+// the pod-template-hash suffix the Deployment adds to the ReplicaSet name.
+func podWorkload(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return fmt.Sprintf("Pod/%s/%s", pod.Namespace, pod.Name)
+	}
+	if hash, ok := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok && owner.Kind == "ReplicaSet" &&
+		strings.HasSuffix(owner.Name, "-"+hash) {
+		return fmt.Sprintf("Deployment/%s/%s", pod.Namespace, strings.TrimSuffix(owner.Name, "-"+hash))
+	}
+	return fmt.Sprintf("%s/%s/%s", owner.Kind, pod.Namespace, owner.Name)
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildImageReport(t *testing.T) {
+	isController := true
+	pod := func(namespace, name string, owner *metav1.OwnerReference, labels map[string]string, statuses ...corev1.ContainerStatus) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: statuses},
+		}
+		if owner != nil {
+			p.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		return p
+	}
+	status := func(image, imageID string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Image: image, ImageID: imageID}
+	}
+	replicaSet := &metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-5d9f8c7b6", Controller: &isController}
+	statefulSet := &metav1.OwnerReference{Kind: "StatefulSet", Name: "db", Controller: &isController}
+
+	completed := pod("default", "job-1", nil, nil, status("busybox:1", "sha256:bbbb"))
+	completed.Status.Phase = corev1.PodSucceeded
+	pods := []corev1.Pod{
+		pod("default", "web-5d9f8c7b6-abcde", replicaSet, map[string]string{"pod-template-hash": "5d9f8c7b6"},
+			status("nginx:1.27", "docker-pullable://nginx@sha256:aaaa"), status("envoy:1.30", "")),
+		pod("default", "web-5d9f8c7b6-fghij", replicaSet, map[string]string{"pod-template-hash": "5d9f8c7b6"},
+			status("nginx:1.27", "docker-pullable://nginx@sha256:aaaa")),
+		pod("data", "db-0", statefulSet, nil, status("nginx:1.27", "nginx@sha256:aaaa"), status("postgres:16", "sha256:cccc")),
+		pod("tools", "debug", nil, nil, status("nginx:1.27", "docker.io/library/nginx@sha256:dddd")),
+		completed,
+	}
+
+	report := buildImageReport("cluster1", pods)
+	want := []ImageInfo{
+		{Image: "nginx:1.27", Digest: "sha256:aaaa", Namespaces: []string{"data", "default"},
+			Workloads: []string{"Deployment/default/web", "StatefulSet/data/db"}, TotalWorkloads: 2},
+		{Image: "nginx:1.27", Digest: "sha256:dddd", Namespaces: []string{"tools"},
+			Workloads: []string{"Pod/tools/debug"}, TotalWorkloads: 1},
+		{Image: "postgres:16", Digest: "sha256:cccc", Namespaces: []string{"data"},
+			Workloads: []string{"StatefulSet/data/db"}, TotalWorkloads: 1},
+	}
+	if report.TotalImages != len(want) || !reflect.DeepEqual(report.Images, want) {
+		t.Errorf("images = %+v, want %+v", report.Images, want)
+	}
+}
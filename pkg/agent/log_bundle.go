@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// LogBundleLabel marks the ConfigMaps holding logs collected by the agent.
+	LogBundleLabel = "basic-addon.open-cluster-management.io/log-bundle"
+	// LogBundleExpiresAtLabel is the Unix time after which the hub deletes a log bundle.
+	LogBundleExpiresAtLabel = "basic-addon.open-cluster-management.io/expires-at"
+	// LogBundleDataKey is the binaryData key of the gzip compressed logs.
+	LogBundleDataKey = "logs.gz"
+
+	// DefaultLogBundleTTL is how long a log bundle is kept on the hub.
+	DefaultLogBundleTTL = 24 * time.Hour
+	maxLogBundleTTL     = 7 * 24 * time.Hour
+
+	// maxLogBundleBytes keeps the compressed logs well below the 1MiB ConfigMap limit.
+	maxLogBundleBytes = 512 << 10
+	// maxContainerLogBytes bounds the logs read from a single container.
+	maxContainerLogBytes = 256 << 10
+	maxLogBundlePods     = 20
+
+	logBundleNameHashLength = 10
+)
+
+// logBundleName returns the name of the ConfigMap holding the logs collected by
+// a command. Names too long for an object are truncated and made unique again
+// with a hash of the command name.
+func logBundleName(commandName string) string {
+	name := "pod-logs-" + commandName
+	if len(name) <= validation.DNS1123SubdomainMaxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(commandName))
+	suffix := "-" + hex.EncodeToString(hash[:])[:logBundleNameHashLength]
+	return strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(suffix)], ".-") + suffix
+}
+
+// collectLogs fetches the logs of the pods matching a label selector, and
+// uploads them to the hub compressed in a ConfigMap owned by the command and
+// labelled with its expiration time.
+// Parameters: namespace, selector, container (optional), tailLines (optional),
+// sinceTime or sinceSeconds (optional), previous (optional) and ttl (optional).
+func (o *AgentOptions) collectLogs(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox,
+	command *unstructured.Unstructured, params map[string]string) (string, error) {
+	namespace, selector := params["namespace"], params["selector"]
+	if len(namespace) == 0 || len(selector) == 0 {
+		return "", fmt.Errorf("parameters namespace and selector are required")
+	}
+	if _, err := labels.Parse(selector); err != nil {
+		return "", fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	logOptions, err := parseLogOptions(params)
+	if err != nil {
+		return "", err
+	}
+	ttl := DefaultLogBundleTTL
+	if value, ok := params["ttl"]; ok {
+		ttl, err = time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return "", fmt.Errorf("invalid ttl %q", value)
+		}
+		ttl = min(ttl, maxLogBundleTTL)
+	}
+
+	pods, err := spokeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no pods match selector %q in namespace %s", selector, namespace)
+	}
+
+	logs, containers, truncated, err := compressPodLogs(ctx, spokeClient, pods.Items, logOptions)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	bundle := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      logBundleName(command.GetName()),
+			Namespace: o.SpokeClusterName,
+			Labels: map[string]string{
+				"app":                   "basic-addon",
+				LogBundleLabel:          "true",
+				LogBundleExpiresAtLabel: strconv.FormatInt(expiresAt.Unix(), 10),
+			},
+			// Deleting the command deletes its logs
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: command.GetAPIVersion(),
+				Kind:       command.GetKind(),
+				Name:       command.GetName(),
+				UID:        command.GetUID(),
+			}},
+		},
+		Data: map[string]string{
+			"namespace":  namespace,
+			"selector":   selector,
+			"containers": strings.Join(containers, "\n"),
+			"truncated":  strconv.FormatBool(truncated),
+		},
+		BinaryData: map[string][]byte{LogBundleDataKey: logs},
+	}
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode log bundle: %w", err)
+	}
+
+	result := fmt.Sprintf("Collected logs of %d containers into ConfigMap %s (%d bytes compressed, expires at %s)",
+		len(containers), bundle.Name, len(logs), expiresAt.UTC().Format(time.RFC3339))
+	if truncated {
+		result += ", truncated to fit the size limit"
+	}
+	if err := outbox.publish(ctx, strategyLogBundles, bundle.Name, payload); err != nil {
+		// The outbox retries the upload, the command result says where the logs will be
+		klog.Errorf("Failed to upload log bundle %s, will retry: %v", bundle.Name, err)
+		result += "; upload pending, the hub is unreachable"
+	}
+	return result, nil
+}
+
+// parseLogOptions returns the pod log options set by the command parameters.
+func parseLogOptions(params map[string]string) (*corev1.PodLogOptions, error) {
+	tailLines, err := parseTailLines(params)
+	if err != nil {
+		return nil, err
+	}
+	limitBytes := int64(maxContainerLogBytes)
+	logOptions := &corev1.PodLogOptions{
+		Container:  params["container"],
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}
+
+	if value, ok := params["previous"]; ok {
+		logOptions.Previous, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous %q", value)
+		}
+	}
+	if value, ok := params["sinceTime"]; ok {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinceTime %q, expected RFC3339", value)
+		}
+		sinceTime := metav1.NewTime(since)
+		logOptions.SinceTime = &sinceTime
+	}
+	if value, ok := params["sinceSeconds"]; ok {
+		if logOptions.SinceTime != nil {
+			return nil, fmt.Errorf("only one of sinceTime and sinceSeconds may be set")
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds %q", value)
+		}
+		logOptions.SinceSeconds = &seconds
+	}
+	return logOptions, nil
+}
+
+// compressPodLogs returns the gzip compressed logs of the containers of the
+// pods, each preceded by a "==> namespace/pod/container <==" header, and the
+// containers included. It stops adding containers once the next one could
+// exceed maxLogBundleBytes, and reports it as truncated.
+func compressPodLogs(ctx context.Context, spokeClient kubernetes.Interface, pods []corev1.Pod,
+	logOptions *corev1.PodLogOptions) ([]byte, []string, bool, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	containers := []string{}
+	truncated := len(pods) > maxLogBundlePods
+	pods = pods[:min(len(pods), maxLogBundlePods)]
+
+collect:
+	for _, pod := range pods {
+		names := []string{logOptions.Container}
+		if len(logOptions.Container) == 0 {
+			names = nil
+			for _, container := range pod.Spec.Containers {
+				names = append(names, container.Name)
+			}
+		}
+
+		for _, name := range names {
+			if err := writer.Flush(); err != nil {
+				return nil, nil, false, err
+			}
+			// Logs never compress to more than their size plus a few bytes
+			if buf.Len()+maxContainerLogBytes+512 > maxLogBundleBytes {
+				truncated = true
+				break collect
+			}
+
+			options := logOptions.DeepCopy()
+			options.Container = name
+			logs, err := spokeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+			if err != nil {
+				// Containers that haven't started, or without a previous instance, have no logs
+				if !errors.IsBadRequest(err) && !errors.IsNotFound(err) {
+					return nil, nil, false, fmt.Errorf("failed to get logs of pod %s/%s container %s: %w",
+						pod.Namespace, pod.Name, name, err)
+				}
+				logs = []byte(fmt.Sprintf("no logs: %v\n", err))
+			}
+
+			ref := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, name)
+			if _, err := fmt.Fprintf(writer, "==> %s <==\n%s\n", ref, logs); err != nil {
+				return nil, nil, false, err
+			}
+			containers = append(containers, ref)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, nil, false, err
+	}
+	return buf.Bytes(), containers, truncated, nil
+}
+
+// publishLogBundle creates the log bundle ConfigMap in the payload on the hub.
+// Bundles are never updated: each command uploads its own.
+func (o *AgentOptions) publishLogBundle(ctx context.Context, hubClient kubernetes.Interface, payload []byte) error {
+	bundle := &corev1.ConfigMap{}
+	if err := utiljson.Unmarshal(payload, bundle); err != nil {
+		return fmt.Errorf("failed to decode log bundle: %w", err)
+	}
+
+	_, err := hubClient.CoreV1().ConfigMaps(bundle.Namespace).Create(ctx, bundle, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create log bundle %s: %w", bundle.Name, err)
+	}
+	klog.Infof("Uploaded log bundle %s", bundle.Name)
+	return nil
+}
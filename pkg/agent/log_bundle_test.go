@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollectLogs(t *testing.T) {
+	pod := func(name string, containers ...string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}}}
+		for _, container := range containers {
+			p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: container})
+		}
+		return p
+	}
+	spokeClient := kubefake.NewSimpleClientset(
+		pod("web-1", "web", "sidecar"),
+		pod("web-2", "web"),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+	)
+	command := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "basic-addon.open-cluster-management.io/v1alpha1",
+		"kind":       "AddonCommand",
+		"metadata":   map[string]interface{}{"name": "logs-abc", "namespace": "cluster1", "uid": "command-uid"},
+	}}
+
+	tests := []struct {
+		name           string
+		params         map[string]string
+		wantErr        string
+		wantContainers []string
+	}{
+		{
+			name:           "all containers",
+			params:         map[string]string{"namespace": "default", "selector": "app=web", "previous": "true", "sinceSeconds": "600"},
+			wantContainers: []string{"default/web-1/web", "default/web-1/sidecar", "default/web-2/web"},
+		},
+		{
+			name:           "one container",
+			params:         map[string]string{"namespace": "default", "selector": "app=web", "container": "web", "sinceTime": "2026-01-01T00:00:00Z"},
+			wantContainers: []string{"default/web-1/web", "default/web-2/web"},
+		},
+		{name: "missing selector", params: map[string]string{"namespace": "default"}, wantErr: "namespace and selector are required"},
+		{name: "invalid selector", params: map[string]string{"namespace": "default", "selector": "app in web"}, wantErr: "invalid selector"},
+		{name: "no matching pods", params: map[string]string{"namespace": "default", "selector": "app=cache"}, wantErr: "no pods match"},
+		{name: "invalid sinceTime", params: map[string]string{"namespace": "default", "selector": "app=web", "sinceTime": "yesterday"}, wantErr: "invalid sinceTime"},
+		{
+			name:    "both since",
+			params:  map[string]string{"namespace": "default", "selector": "app=web", "sinceTime": "2026-01-01T00:00:00Z", "sinceSeconds": "60"},
+			wantErr: "only one of sinceTime and sinceSeconds",
+		},
+		{name: "invalid ttl", params: map[string]string{"namespace": "default", "selector": "app=web", "ttl": "-1h"}, wantErr: "invalid ttl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hubClient := kubefake.NewSimpleClientset()
+			opts := NewAgentOptions("basic-addon")
+			opts.SpokeClusterName = "cluster1"
+			b, err := newOutbox("", DefaultOutboxMaxEntries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.register(strategyLogBundles, func(ctx context.Context, payload []byte) error {
+				return opts.publishLogBundle(ctx, hubClient, payload)
+			})
+
+			result, err := opts.collectLogs(context.TODO(), spokeClient, b, command, tt.params)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("collectLogs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("collectLogs() error = %v", err)
+			}
+			if !strings.Contains(result, logBundleName("logs-abc")) {
+				t.Errorf("result %q doesn't name the log bundle", result)
+			}
+
+			bundle, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), logBundleName("logs-abc"), metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("log bundle was not uploaded: %v", err)
+			}
+			if bundle.Labels[LogBundleLabel] != "true" || len(bundle.Labels[LogBundleExpiresAtLabel]) == 0 {
+				t.Errorf("unexpected labels %v", bundle.Labels)
+			}
+			if len(bundle.OwnerReferences) != 1 || bundle.OwnerReferences[0].UID != "command-uid" {
+				t.Errorf("log bundle is not owned by the command: %v", bundle.OwnerReferences)
+			}
+			if got := strings.Split(bundle.Data["containers"], "\n"); !reflect.DeepEqual(got, tt.wantContainers) {
+				t.Errorf("containers = %v, want %v", got, tt.wantContainers)
+			}
+
+			reader, err := gzip.NewReader(bytes.NewReader(bundle.BinaryData[LogBundleDataKey]))
+			if err != nil {
+				t.Fatalf("logs are not gzip compressed: %v", err)
+			}
+			logs, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, container := range tt.wantContainers {
+				if !strings.Contains(string(logs), "==> "+container+" <==\nfake logs") {
+					t.Errorf("logs of %s are missing:\n%s", container, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestLogBundleName(t *testing.T) {
+	// Cut right after the dot, which must not end the name
+	long := strings.Repeat("a", 232) + "." + strings.Repeat("b", 20)
+	tests := []struct {
+		name        string
+		commandName string
+		want        string
+	}{
+		{name: "short name", commandName: "logs-abc", want: "pod-logs-logs-abc"},
+		{name: "name at the limit", commandName: strings.Repeat("a", 244), want: "pod-logs-" + strings.Repeat("a", 244)},
+		{name: "long name", commandName: long},
+		{name: "long name differing at the end", commandName: long[:len(long)-1] + "c"},
+	}
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logBundleName(tt.commandName)
+			if len(tt.want) > 0 && got != tt.want {
+				t.Errorf("logBundleName() = %s, want %s", got, tt.want)
+			}
+			if errs := validation.IsDNS1123Subdomain(got); len(errs) > 0 {
+				t.Errorf("logBundleName() = %s is not a valid name: %v", got, errs)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("logBundleName() = %s for both %s and %s", got, other, tt.commandName)
+			}
+			seen[got] = tt.commandName
+		})
+	}
+}
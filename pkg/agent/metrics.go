@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// Agent metrics are served on /metrics by the controller command server.
+var (
+	outboxPendingItems = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      "basic_addon",
+			Subsystem:      "agent",
+			Name:           "outbox_pending_items",
+			Help:           "Number of hub writes buffered in the outbox, by strategy.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"strategy"},
+	)
+
+	outboxOldestPendingAge = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      "basic_addon",
+			Subsystem:      "agent",
+			Name:           "outbox_oldest_pending_age_seconds",
+			Help:           "Age of the oldest hub write buffered in the outbox, by strategy.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"strategy"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(outboxPendingItems)
+	legacyregistry.MustRegister(outboxOldestPendingAge)
+}
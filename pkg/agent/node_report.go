@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// NodeReportConfigMapName is the ConfigMap with the health of the spoke nodes.
+	NodeReportConfigMapName = "node-report"
+
+	// NodesHealthyConditionType is the addon condition summarizing the node report.
+	NodesHealthyConditionType = "NodesHealthy"
+
+	// maxConditionNodes bounds the nodes named in the NodesHealthy message.
+	maxConditionNodes = 10
+	// maxNodeReportEntries keeps the node report below the ConfigMap size limit.
+	maxNodeReportEntries = 1000
+)
+
+// nodePressureConditions are the node conditions that are unhealthy when True.
+var nodePressureConditions = []corev1.NodeConditionType{
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+}
+
+// NodeReport is the structure sent to the hub with the health of the spoke nodes.
+type NodeReport struct {
+	ClusterName string    `json:"clusterName"`
+	Timestamp   time.Time `json:"timestamp"`
+	TotalNodes  int       `json:"totalNodes"`
+	ReadyNodes  int       `json:"readyNodes"`
+	// Truncated is set when nodes were left out of the report.
+	Truncated bool       `json:"truncated,omitempty"`
+	Nodes     []NodeInfo `json:"nodes"`
+}
+
+// NodeInfo contains the health and capacity of a single node.
+type NodeInfo struct {
+	Name string `json:"name"`
+	// Conditions maps Ready, MemoryPressure, DiskPressure and PIDPressure to
+	// their status (True, False or Unknown).
+	Conditions     map[string]string `json:"conditions"`
+	KubeletVersion string            `json:"kubeletVersion"`
+	OSImage        string            `json:"osImage,omitempty"`
+	OS             string            `json:"os"`
+	Architecture   string            `json:"architecture"`
+	Capacity       map[string]string `json:"capacity"`
+	Allocatable    map[string]string `json:"allocatable"`
+	Taints         []string          `json:"taints,omitempty"`
+	Unschedulable  bool              `json:"unschedulable,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	Age            string            `json:"age"`
+}
+
+// syncNodeReport collects the nodes of the spoke, sends the node report to the
+// hub and sets the NodesHealthy condition of the addon.
+func (o *AgentOptions) syncNodeReport(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox) error {
+	klog.V(4).Info("Syncing node report")
+
+	nodes, err := spokeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	report := buildNodeReport(o.SpokeClusterName, nodes.Items)
+	// The condition looks at every node, before the report is truncated
+	condition := nodesHealthyCondition(report)
+	truncateNodeReport(&report)
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := outbox.publish(ctx, strategyNodeReport, NodeReportConfigMapName, reportJSON); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(condition)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyAddonStatus, NodesHealthyConditionType, payload)
+}
+
+// publishNodeReport creates or updates the node report ConfigMap in hub.
+func (o *AgentOptions) publishNodeReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, NodeReportConfigMapName, reportJSON)
+}
+
+// buildNodeReport creates a NodeReport from a list of nodes.
+func buildNodeReport(clusterName string, nodes []corev1.Node) NodeReport {
+	now := time.Now().UTC()
+	report := NodeReport{
+		ClusterName: clusterName,
+		Timestamp:   now,
+		TotalNodes:  len(nodes),
+		Nodes:       make([]NodeInfo, 0, len(nodes)),
+	}
+
+	for _, node := range nodes {
+		info := NodeInfo{
+			Name:           node.Name,
+			Conditions:     map[string]string{},
+			KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+			OSImage:        node.Status.NodeInfo.OSImage,
+			OS:             node.Status.NodeInfo.OperatingSystem,
+			Architecture:   node.Status.NodeInfo.Architecture,
+			Capacity:       resourceStrings(node.Status.Capacity),
+			Allocatable:    resourceStrings(node.Status.Allocatable),
+			Unschedulable:  node.Spec.Unschedulable,
+			CreatedAt:      node.CreationTimestamp.UTC(),
+			Age:            duration.HumanDuration(now.Sub(node.CreationTimestamp.Time)),
+		}
+		// Conditions missing from the node status are Unknown
+		for _, conditionType := range append([]corev1.NodeConditionType{corev1.NodeReady}, nodePressureConditions...) {
+			info.Conditions[string(conditionType)] = string(corev1.ConditionUnknown)
+		}
+		for _, condition := range node.Status.Conditions {
+			if _, ok := info.Conditions[string(condition.Type)]; ok {
+				info.Conditions[string(condition.Type)] = string(condition.Status)
+			}
+		}
+		for _, taint := range node.Spec.Taints {
+			info.Taints = append(info.Taints, taint.ToString())
+		}
+
+		if info.Conditions[string(corev1.NodeReady)] == string(corev1.ConditionTrue) {
+			report.ReadyNodes++
+		}
+		report.Nodes = append(report.Nodes, info)
+	}
+
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		return report.Nodes[i].Name < report.Nodes[j].Name
+	})
+	return report
+}
+
+// truncateNodeReport keeps at most maxNodeReportEntries nodes in the report,
+// the NotReady and pressured ones first.
+func truncateNodeReport(report *NodeReport) {
+	if len(report.Nodes) <= maxNodeReportEntries {
+		return
+	}
+	sort.SliceStable(report.Nodes, func(i, j int) bool {
+		return nodeUnhealthy(report.Nodes[i]) && !nodeUnhealthy(report.Nodes[j])
+	})
+	report.Nodes = report.Nodes[:maxNodeReportEntries]
+	report.Truncated = true
+}
+
+// nodeUnhealthy returns whether the node is not Ready or under pressure.
+func nodeUnhealthy(node NodeInfo) bool {
+	if node.Conditions[string(corev1.NodeReady)] != string(corev1.ConditionTrue) {
+		return true
+	}
+	for _, conditionType := range nodePressureConditions {
+		if node.Conditions[string(conditionType)] == string(corev1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceStrings returns the cpu, memory and pods of a resource list as strings.
+func resourceStrings(resources corev1.ResourceList) map[string]string {
+	values := map[string]string{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourcePods} {
+		if quantity, ok := resources[name]; ok {
+			values[string(name)] = quantity.String()
+		}
+	}
+	return values
+}
+
+// nodesHealthyCondition returns the NodesHealthy condition summarizing the
+// node report: nodes are healthy when all of them are Ready and none is
+// under memory, disk or PID pressure.
+func nodesHealthyCondition(report NodeReport) map[string]interface{} {
+	var notReady, underPressure []string
+	for _, node := range report.Nodes {
+		if node.Conditions[string(corev1.NodeReady)] != string(corev1.ConditionTrue) {
+			notReady = append(notReady, node.Name)
+		}
+		var pressures []string
+		for _, conditionType := range nodePressureConditions {
+			if node.Conditions[string(conditionType)] == string(corev1.ConditionTrue) {
+				pressures = append(pressures, string(conditionType))
+			}
+		}
+		if len(pressures) > 0 {
+			underPressure = append(underPressure, fmt.Sprintf("%s (%s)", node.Name, strings.Join(pressures, ", ")))
+		}
+	}
+
+	status := metav1.ConditionTrue
+	reason := "AllNodesHealthy"
+	message := fmt.Sprintf("%d/%d nodes are Ready", report.ReadyNodes, report.TotalNodes)
+	switch {
+	case report.TotalNodes == 0:
+		status = metav1.ConditionFalse
+		reason = "NoNodes"
+		message = "The cluster has no nodes"
+	case len(notReady) > 0:
+		status = metav1.ConditionFalse
+		reason = "NodesNotReady"
+		message = fmt.Sprintf("%d/%d nodes are Ready, not Ready: %s",
+			report.ReadyNodes, report.TotalNodes, truncatedList(notReady, maxConditionNodes))
+		if len(underPressure) > 0 {
+			message += fmt.Sprintf("; under pressure: %s", truncatedList(underPressure, maxConditionNodes))
+		}
+	case len(underPressure) > 0:
+		status = metav1.ConditionFalse
+		reason = "NodesUnderPressure"
+		message = fmt.Sprintf("%d/%d nodes are Ready, under pressure: %s",
+			report.ReadyNodes, report.TotalNodes, truncatedList(underPressure, maxConditionNodes))
+	}
+
+	return map[string]interface{}{
+		"type":               NodesHealthyConditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": metav1.Now().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// truncatedList joins the first limit items, followed by how many were left out.
+func truncatedList(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:limit], ", "), len(items)-limit)
+}
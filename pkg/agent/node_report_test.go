@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildNodeReport(t *testing.T) {
+	node := func(name string, ready corev1.ConditionStatus, pressure ...corev1.NodeConditionType) corev1.Node {
+		n := corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(time.Now().Add(-48 * time.Hour))},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+				NodeInfo:   corev1.NodeSystemInfo{KubeletVersion: "v1.30.2", OperatingSystem: "linux", Architecture: "amd64"},
+				Capacity: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("4"),
+					corev1.ResourceMemory: resource.MustParse("16Gi"),
+					corev1.ResourcePods:   resource.MustParse("110"),
+				},
+				Allocatable: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("3800m"),
+					corev1.ResourceMemory: resource.MustParse("15Gi"),
+					corev1.ResourcePods:   resource.MustParse("110"),
+				},
+			},
+		}
+		for _, conditionType := range pressure {
+			n.Status.Conditions = append(n.Status.Conditions, corev1.NodeCondition{Type: conditionType, Status: corev1.ConditionTrue})
+		}
+		return n
+	}
+	cordoned := node("node-c", corev1.ConditionTrue)
+	cordoned.Spec.Unschedulable = true
+	cordoned.Spec.Taints = []corev1.Taint{{Key: "node.kubernetes.io/unschedulable", Effect: corev1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		name       string
+		nodes      []corev1.Node
+		wantReady  int
+		wantStatus string
+		wantReason string
+		wantInMsg  string
+	}{
+		{
+			name:       "all healthy",
+			nodes:      []corev1.Node{node("node-a", corev1.ConditionTrue), cordoned},
+			wantReady:  2,
+			wantStatus: "True",
+			wantReason: "AllNodesHealthy",
+			wantInMsg:  "2/2 nodes are Ready",
+		},
+		{
+			name:       "not ready",
+			nodes:      []corev1.Node{node("node-a", corev1.ConditionTrue), node("node-b", corev1.ConditionUnknown)},
+			wantReady:  1,
+			wantStatus: "False",
+			wantReason: "NodesNotReady",
+			wantInMsg:  "not Ready: node-b",
+		},
+		{
+			name:       "under pressure",
+			nodes:      []corev1.Node{node("node-a", corev1.ConditionTrue, corev1.NodeMemoryPressure, corev1.NodeDiskPressure)},
+			wantReady:  1,
+			wantStatus: "False",
+			wantReason: "NodesUnderPressure",
+			wantInMsg:  "node-a (MemoryPressure, DiskPressure)",
+		},
+		{
+			name:       "no nodes",
+			wantStatus: "False",
+			wantReason: "NoNodes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := buildNodeReport("cluster1", tt.nodes)
+			if report.TotalNodes != len(tt.nodes) || report.ReadyNodes != tt.wantReady {
+				t.Errorf("TotalNodes = %d, ReadyNodes = %d, want %d, %d", report.TotalNodes, report.ReadyNodes, len(tt.nodes), tt.wantReady)
+			}
+			condition := nodesHealthyCondition(report)
+			if condition["status"] != tt.wantStatus || condition["reason"] != tt.wantReason {
+				t.Errorf("condition = %v, want %s/%s", condition, tt.wantStatus, tt.wantReason)
+			}
+			if !strings.Contains(condition["message"].(string), tt.wantInMsg) {
+				t.Errorf("message %q doesn't contain %q", condition["message"], tt.wantInMsg)
+			}
+		})
+	}
+
+	report := buildNodeReport("cluster1", []corev1.Node{cordoned})
+	got := report.Nodes[0]
+	want := NodeInfo{
+		Name: "node-c",
+		Conditions: map[string]string{
+			"Ready": "True", "MemoryPressure": "Unknown", "DiskPressure": "Unknown", "PIDPressure": "Unknown",
+		},
+		KubeletVersion: "v1.30.2",
+		OS:             "linux",
+		Architecture:   "amd64",
+		Capacity:       map[string]string{"cpu": "4", "memory": "16Gi", "pods": "110"},
+		Allocatable:    map[string]string{"cpu": "3800m", "memory": "15Gi", "pods": "110"},
+		Taints:         []string{"node.kubernetes.io/unschedulable:NoSchedule"},
+		Unschedulable:  true,
+		CreatedAt:      cordoned.CreationTimestamp.UTC(),
+		Age:            "2d",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("node info = %+v, want %+v", got, want)
+	}
+}
+
+func TestTruncateNodeReport(t *testing.T) {
+	nodes := make([]corev1.Node, 0, maxNodeReportEntries+2)
+	for i := 0; i < maxNodeReportEntries; i++ {
+		nodes = append(nodes, corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%04d", i)},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+		})
+	}
+	// Sorted last by name, but unhealthy
+	nodes = append(nodes,
+		corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "zz-not-ready"}},
+		corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "zz-pressure"},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue},
+			}},
+		},
+	)
+
+	report := buildNodeReport("cluster1", nodes)
+	condition := nodesHealthyCondition(report)
+	truncateNodeReport(&report)
+
+	if !report.Truncated || len(report.Nodes) != maxNodeReportEntries || report.TotalNodes != maxNodeReportEntries+2 {
+		t.Fatalf("truncated = %v with %d of %d nodes", report.Truncated, len(report.Nodes), report.TotalNodes)
+	}
+	if report.Nodes[0].Name != "zz-not-ready" || report.Nodes[1].Name != "zz-pressure" {
+		t.Errorf("first nodes = %s, %s, want the unhealthy ones", report.Nodes[0].Name, report.Nodes[1].Name)
+	}
+	if message := condition["message"].(string); !strings.Contains(message, "zz-not-ready") || !strings.Contains(message, "zz-pressure") {
+		t.Errorf("condition message %q doesn't name the unhealthy nodes", message)
+	}
+}
+
+func TestSyncNodeReport(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}},
+	})
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyNodeReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishNodeReport(ctx, hubClient, payload)
+	})
+	var condition map[string]interface{}
+	b.register(strategyAddonStatus, func(ctx context.Context, payload []byte) error {
+		return json.Unmarshal(payload, &condition)
+	})
+
+	if err := opts.syncNodeReport(context.TODO(), spokeClient, b); err != nil {
+		t.Fatalf("syncNodeReport() error = %v", err)
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), NodeReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("node report was not published: %v", err)
+	}
+	report := NodeReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalNodes != 1 || report.ReadyNodes != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if condition["type"] != NodesHealthyConditionType || condition["status"] != "False" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+}
@@ -0,0 +1,364 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultOutboxMaxEntries bounds the number of pending hub writes kept in the outbox.
+	DefaultOutboxMaxEntries = 64
+	// outboxMaxPayloadBytes matches the ConfigMap size limit; bigger payloads can't be written anyway.
+	outboxMaxPayloadBytes = 1 << 20
+
+	outboxInitialBackoff = 5 * time.Second
+	outboxMaxBackoff     = 5 * time.Minute
+	outboxJitterFactor   = 0.5
+	outboxReplayInterval = 5 * time.Second
+)
+
+var outboxFileNameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// publishFunc writes a strategy payload to the hub.
+type publishFunc func(ctx context.Context, payload []byte) error
+
+// outboxEntry is a hub write that failed and is waiting to be retried.
+type outboxEntry struct {
+	Strategy    string    `json:"strategy"`
+	Key         string    `json:"key"`
+	Payload     []byte    `json:"payload"`
+	QueuedAt    time.Time `json:"queuedAt"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// outbox buffers hub writes that failed, for example while the hub is
+// unreachable, and retries them with exponential backoff and jitter. Only the
+// latest payload per strategy and object is kept, so a reconnect replays the
+// current state instead of every missed cycle. When dir is set, entries are
+// persisted there and survive agent restarts. There is at most one write of
+// an object in flight: a payload published meanwhile is buffered and written
+// after it, so a slow write can't overwrite a newer state on the hub.
+type outbox struct {
+	dir        string
+	maxEntries int
+	now        func() time.Time
+
+	lock       sync.Mutex
+	entries    map[string]*outboxEntry
+	inFlight   sets.Set[string]
+	publishers map[string]publishFunc
+}
+
+// newOutbox returns an outbox persisted in dir, loading the entries already there.
+// An empty dir keeps the entries in memory only.
+func newOutbox(dir string, maxEntries int) (*outbox, error) {
+	b := &outbox{
+		dir:        dir,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]*outboxEntry{},
+		inFlight:   sets.New[string](),
+		publishers: map[string]publishFunc{},
+	}
+	if len(dir) == 0 {
+		return b, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		entry := &outboxEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			klog.Errorf("Discarding corrupted outbox entry %s: %v", file, err)
+			_ = os.Remove(file)
+			continue
+		}
+		b.entries[outboxKey(entry.Strategy, entry.Key)] = entry
+	}
+	if len(b.entries) > 0 {
+		klog.Infof("Loaded %d pending hub writes from %s", len(b.entries), dir)
+	}
+	b.updateMetrics()
+	return b, nil
+}
+
+// register sets the function used to write payloads of a strategy to the hub.
+func (b *outbox) register(strategy string, publish publishFunc) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.publishers[strategy] = publish
+}
+
+// publish writes the payload to the hub. If the write fails, an earlier write
+// of the same object is still backing off or another write of it is in flight,
+// the payload replaces the pending one and is written later. A pending write
+// whose backoff expired is superseded by the payload written now, so it can't
+// be replayed over it afterwards. A buffered payload
+// is as good as written for the caller, so the returned error is only set when
+// the payload could be neither written nor buffered: hub outages are retried
+// here and must not count as strategy failures.
+func (b *outbox) publish(ctx context.Context, strategy, key string, payload []byte) error {
+	b.lock.Lock()
+	entry, pending := b.entries[outboxKey(strategy, key)]
+	if b.inFlight.Has(outboxKey(strategy, key)) || (pending && b.now().Before(entry.NextAttempt)) {
+		err := b.bufferLatest(strategy, key, payload)
+		b.lock.Unlock()
+		klog.V(4).Infof("Hub write %s/%s is in flight or backing off, buffered latest state", strategy, key)
+		return err
+	}
+	publisher, ok := b.publishers[strategy]
+	if !ok {
+		b.lock.Unlock()
+		return fmt.Errorf("no publisher registered for strategy %s", strategy)
+	}
+	b.inFlight.Insert(outboxKey(strategy, key))
+	if pending {
+		// Keep the backoff of the pending write but not its stale payload
+		if err := b.bufferLatest(strategy, key, payload); err != nil {
+			b.remove(strategy, key)
+		}
+	}
+	b.lock.Unlock()
+
+	err := publisher(ctx, payload)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err != nil {
+		klog.V(2).Infof("Hub write %s/%s failed, buffered for retry: %v", strategy, key, err)
+	}
+	return b.finish(strategy, key, payload, err)
+}
+
+// replay retries the pending writes whose backoff has expired.
+func (b *outbox) replay(ctx context.Context) {
+	b.lock.Lock()
+	var due []outboxEntry
+	for key, entry := range b.entries {
+		if _, ok := b.publishers[entry.Strategy]; !ok || b.inFlight.Has(key) || b.now().Before(entry.NextAttempt) {
+			continue
+		}
+		b.inFlight.Insert(key)
+		due = append(due, *entry)
+	}
+	b.lock.Unlock()
+
+	for _, entry := range due {
+		b.lock.Lock()
+		publisher := b.publishers[entry.Strategy]
+		b.lock.Unlock()
+
+		err := publisher(ctx, entry.Payload)
+
+		b.lock.Lock()
+		if err == nil {
+			klog.Infof("Replayed buffered hub write %s/%s after %d attempts", entry.Strategy, entry.Key, entry.Attempts)
+		} else {
+			klog.V(2).Infof("Retry of hub write %s/%s failed: %v", entry.Strategy, entry.Key, err)
+		}
+		if bufferErr := b.finish(entry.Strategy, entry.Key, entry.Payload, err); bufferErr != nil {
+			klog.Errorf("Failed to buffer hub write %s/%s: %v", entry.Strategy, entry.Key, bufferErr)
+		}
+		b.lock.Unlock()
+	}
+
+	b.lock.Lock()
+	b.updateMetrics()
+	b.lock.Unlock()
+}
+
+// finish records the result of writing payload to the hub and releases the
+// object for the next write. A payload buffered while the write was in flight
+// is newer than the written one: it is kept and written on the next replay,
+// right away on success. The returned error is set when a payload that must be
+// retried could not be buffered. Must be called with the lock held.
+func (b *outbox) finish(strategy, key string, payload []byte, err error) error {
+	b.inFlight.Delete(outboxKey(strategy, key))
+	current, pending := b.entries[outboxKey(strategy, key)]
+	newer := pending && string(current.Payload) != string(payload)
+	switch {
+	case err == nil && newer:
+		current.NextAttempt = b.now()
+		return b.persist(current)
+	case err == nil:
+		b.remove(strategy, key)
+		return nil
+	default:
+		if newer {
+			payload = current.Payload
+		}
+		if bufferErr := b.buffer(strategy, key, payload); bufferErr != nil {
+			return fmt.Errorf("failed to buffer hub write after %v: %w", err, bufferErr)
+		}
+		return nil
+	}
+}
+
+// run replays pending writes until the context is done.
+func (b *outbox) run(ctx context.Context) {
+	wait.UntilWithContext(ctx, b.replay, outboxReplayInterval)
+}
+
+// buffer stores the payload as the pending write of the object and schedules
+// the next attempt. Must be called with the lock held.
+func (b *outbox) buffer(strategy, key string, payload []byte) error {
+	if len(payload) > outboxMaxPayloadBytes {
+		return fmt.Errorf("payload of %d bytes exceeds the outbox limit of %d bytes", len(payload), outboxMaxPayloadBytes)
+	}
+
+	entry, ok := b.entries[outboxKey(strategy, key)]
+	if !ok {
+		if len(b.entries) >= b.maxEntries {
+			b.evictOldest()
+		}
+		entry = &outboxEntry{Strategy: strategy, Key: key, QueuedAt: b.now()}
+		b.entries[outboxKey(strategy, key)] = entry
+	}
+	entry.Payload = payload
+	entry.Attempts++
+	entry.NextAttempt = b.now().Add(outboxBackoff(entry.Attempts))
+
+	b.updateMetrics()
+	return b.persist(entry)
+}
+
+// bufferLatest stores the payload as the pending write of the object, keeping
+// its backoff. A new entry is written on the next replay. Must be called with
+// the lock held.
+func (b *outbox) bufferLatest(strategy, key string, payload []byte) error {
+	if len(payload) > outboxMaxPayloadBytes {
+		return fmt.Errorf("payload of %d bytes exceeds the outbox limit of %d bytes", len(payload), outboxMaxPayloadBytes)
+	}
+
+	entry, ok := b.entries[outboxKey(strategy, key)]
+	if !ok {
+		if len(b.entries) >= b.maxEntries {
+			b.evictOldest()
+		}
+		entry = &outboxEntry{Strategy: strategy, Key: key, QueuedAt: b.now(), NextAttempt: b.now()}
+		b.entries[outboxKey(strategy, key)] = entry
+		b.updateMetrics()
+	}
+	entry.Payload = payload
+	return b.persist(entry)
+}
+
+// remove drops the pending write of the object. Must be called with the lock held.
+func (b *outbox) remove(strategy, key string) {
+	if _, ok := b.entries[outboxKey(strategy, key)]; !ok {
+		return
+	}
+	delete(b.entries, outboxKey(strategy, key))
+	if len(b.dir) > 0 {
+		if err := os.Remove(b.entryFile(strategy, key)); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("Failed to remove outbox entry %s/%s: %v", strategy, key, err)
+		}
+	}
+	b.updateMetrics()
+}
+
+// evictOldest drops the oldest pending write to make room for a new one.
+// Must be called with the lock held.
+func (b *outbox) evictOldest() {
+	var oldest *outboxEntry
+	for _, entry := range b.entries {
+		if oldest == nil || entry.QueuedAt.Before(oldest.QueuedAt) {
+			oldest = entry
+		}
+	}
+	if oldest != nil {
+		klog.Warningf("Outbox is full, dropping pending hub write %s/%s", oldest.Strategy, oldest.Key)
+		b.remove(oldest.Strategy, oldest.Key)
+	}
+}
+
+// persist writes the entry to disk atomically. Must be called with the lock held.
+func (b *outbox) persist(entry *outboxEntry) error {
+	if len(b.dir) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file := b.entryFile(entry.Strategy, entry.Key)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// updateMetrics refreshes the outbox gauges. Must be called with the lock held.
+func (b *outbox) updateMetrics() {
+	outboxPendingItems.Reset()
+	outboxOldestPendingAge.Reset()
+	oldest := map[string]time.Time{}
+	for _, entry := range b.entries {
+		outboxPendingItems.WithLabelValues(entry.Strategy).Inc()
+		if queuedAt, ok := oldest[entry.Strategy]; !ok || entry.QueuedAt.Before(queuedAt) {
+			oldest[entry.Strategy] = entry.QueuedAt
+		}
+	}
+	for strategy, queuedAt := range oldest {
+		outboxOldestPendingAge.WithLabelValues(strategy).Set(b.now().Sub(queuedAt).Seconds())
+	}
+}
+
+// pending returns the number of pending writes.
+func (b *outbox) pending() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.entries)
+}
+
+// pendingPayload returns the payload of the pending write of the object, if any.
+func (b *outbox) pendingPayload(strategy, key string) ([]byte, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	entry, ok := b.entries[outboxKey(strategy, key)]
+	if !ok {
+		return nil, false
+	}
+	return entry.Payload, true
+}
+
+func (b *outbox) entryFile(strategy, key string) string {
+	return filepath.Join(b.dir, outboxFileNameSanitizer.ReplaceAllString(outboxKey(strategy, key), "_")+".json")
+}
+
+func outboxKey(strategy, key string) string {
+	return strategy + "." + key
+}
+
+// outboxBackoff returns the jittered delay before the given retry attempt.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxInitialBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return wait.Jitter(delay, outboxJitterFactor)
+}
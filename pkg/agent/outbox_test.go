@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxBuffersFailedWrites(t *testing.T) {
+	dir := t.TempDir()
+	b, err := newOutbox(dir, DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	var published []string
+	hubDown := true
+	b.register(strategyPodReport, func(ctx context.Context, payload []byte) error {
+		if hubDown {
+			return fmt.Errorf("hub unreachable")
+		}
+		published = append(published, string(payload))
+		return nil
+	})
+
+	// A buffered write is not a strategy failure
+	if err := b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v1")); err != nil {
+		t.Fatalf("publish() while the hub is down error = %v", err)
+	}
+	// Still backing off: the latest state replaces the pending one without a write attempt
+	if err := b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v2")); err != nil {
+		t.Fatalf("publish() during backoff error = %v", err)
+	}
+	if b.pending() != 1 {
+		t.Fatalf("pending = %d, want 1", b.pending())
+	}
+
+	// Pending writes survive a restart
+	restored, err := newOutbox(dir, DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	if restored.pending() != 1 {
+		t.Fatalf("restored pending = %d, want 1", restored.pending())
+	}
+
+	// Hub is back: only the latest state is replayed once the backoff expires
+	hubDown = false
+	b.replay(context.TODO())
+	if len(published) != 0 {
+		t.Fatalf("replayed before backoff expired: %v", published)
+	}
+	now = now.Add(outboxMaxBackoff * 2)
+	b.replay(context.TODO())
+	if len(published) != 1 || published[0] != "v2" {
+		t.Errorf("published = %v, want [v2]", published)
+	}
+	if b.pending() != 0 {
+		t.Errorf("pending = %d, want 0", b.pending())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("outbox files left after replay: %v", files)
+	}
+}
+
+func TestOutboxReplayDoesNotOverwriteNewerState(t *testing.T) {
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	// The hub keeps the last payload written. The write of v1 is slow: it
+	// lands on the hub only when released.
+	var lock sync.Mutex
+	var hub string
+	var writes []string
+	started, release := make(chan struct{}), make(chan struct{})
+	hubDown := true
+	b.register(strategyPodReport, func(ctx context.Context, payload []byte) error {
+		if hubDown {
+			return fmt.Errorf("hub unreachable")
+		}
+		if string(payload) == "v1" {
+			close(started)
+			<-release
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		hub = string(payload)
+		writes = append(writes, hub)
+		return nil
+	})
+
+	_ = b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v1"))
+	hubDown = false
+	now = now.Add(outboxMaxBackoff * 2)
+
+	replayed := make(chan struct{})
+	go func() {
+		b.replay(context.TODO())
+		close(replayed)
+	}()
+	<-started
+
+	// A sync cycle publishes a newer state while the replay of v1 is in flight
+	if err := b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v2")); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	close(release)
+	<-replayed
+
+	// The newer state is written after the stale one, on the next replay
+	b.replay(context.TODO())
+	lock.Lock()
+	defer lock.Unlock()
+	if hub != "v2" || !reflect.DeepEqual(writes, []string{"v1", "v2"}) {
+		t.Errorf("hub = %q after writes %v, want v2 after [v1 v2]", hub, writes)
+	}
+	if b.pending() != 0 {
+		t.Errorf("pending = %d, want 0", b.pending())
+	}
+}
+
+func TestOutboxPublishSupersedesExpiredPendingWrite(t *testing.T) {
+	b, err := newOutbox(t.TempDir(), DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	var hub string
+	var writes []string
+	hubDown := true
+	b.register(strategyPodReport, func(ctx context.Context, payload []byte) error {
+		if hubDown {
+			return fmt.Errorf("hub unreachable")
+		}
+		hub = string(payload)
+		writes = append(writes, hub)
+		return nil
+	})
+
+	// v1 is buffered and its backoff expires before the next replay
+	_ = b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v1"))
+	hubDown = false
+	now = now.Add(outboxMaxBackoff * 2)
+
+	// A sync cycle writes v2 directly, then the replay must not write v1 over it
+	if err := b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, []byte("v2")); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	b.replay(context.TODO())
+	if hub != "v2" || !reflect.DeepEqual(writes, []string{"v2"}) {
+		t.Errorf("hub = %q after writes %v, want v2 after [v2]", hub, writes)
+	}
+	if b.pending() != 0 {
+		t.Errorf("pending = %d, want 0", b.pending())
+	}
+}
+
+func TestOutboxPublishFailsWhenNotBuffered(t *testing.T) {
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	b.register(strategyPodReport, func(ctx context.Context, payload []byte) error {
+		return fmt.Errorf("hub unreachable")
+	})
+
+	if err := b.publish(context.TODO(), strategyPodReport, PodReportConfigMapName, make([]byte, outboxMaxPayloadBytes+1)); err == nil {
+		t.Error("expected publish error for a payload that can't be buffered")
+	}
+	if err := b.publish(context.TODO(), strategyNodeReport, NodeReportConfigMapName, []byte("v1")); err == nil {
+		t.Error("expected publish error for a strategy without publisher")
+	}
+}
+
+func TestOutboxEvictsOldestWhenFull(t *testing.T) {
+	b, err := newOutbox("", 2)
+	if err != nil {
+		t.Fatalf("newOutbox() error = %v", err)
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.register(strategyPlacementScore, func(ctx context.Context, payload []byte) error {
+		return fmt.Errorf("hub unreachable")
+	})
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = b.publish(context.TODO(), strategyPlacementScore, key, []byte(key))
+		now = now.Add(time.Second)
+	}
+
+	if b.pending() != 2 {
+		t.Fatalf("pending = %d, want 2", b.pending())
+	}
+	if _, ok := b.entries[outboxKey(strategyPlacementScore, "a")]; ok {
+		t.Error("expected oldest entry to be evicted")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	for attempts := 1; attempts <= 10; attempts++ {
+		delay := outboxBackoff(attempts)
+		if delay < outboxInitialBackoff {
+			t.Errorf("outboxBackoff(%d) = %s, below initial backoff", attempts, delay)
+		}
+		if delay > time.Duration(float64(outboxMaxBackoff)*(1+outboxJitterFactor)) {
+			t.Errorf("outboxBackoff(%d) = %s, above max backoff", attempts, delay)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -20,25 +24,14 @@ var scoreGVR = schema.GroupVersionResource{
 
 const PlacementScoreName = "basic-addon-score"
 
-// normalizeScore converts a count to a score in [-100, 100] range.
-// Fewer resources = higher score (more capacity available).
-// score = 100 - (count * 200 / maxExpected), clamped to [-100, 100]
-func normalizeScore(count, maxExpected int) int64 {
-	// Calculate score: 100 when count=0, -100 when count=maxExpected
-	score := 100 - (count * 200 / maxExpected)
-	// Clamp to valid range
-	if score > 100 {
-		score = 100
-	}
-	if score < -100 {
-		score = -100
-	}
-	return int64(score)
-}
-
-// syncPlacementScore creates/updates AddOnPlacementScore with namespace count.
-// This demonstrates how agents can publish metrics for Placement decisions.
-func (o *AgentOptions) syncPlacementScore(ctx context.Context, spokeClient kubernetes.Interface, hubDynamicClient dynamic.Interface) error {
+// syncPlacementScore creates/updates AddOnPlacementScore with scores computed
+// from namespace and pod counts and the free capacity of the cluster, so
+// Placements can prioritize clusters that can actually fit a workload. The
+// scores and how they are normalized come from the scorer configuration, and
+// the smoother damps their swings between cycles. The free storage is only read
+// from the kubelets when a scorer uses it.
+func (o *AgentOptions) syncPlacementScore(ctx context.Context, spokeClient kubernetes.Interface,
+	volumeStats volumeStatsFunc, outbox *outbox, smoother *scoreSmoother) error {
 	klog.V(4).Info("Syncing placement score")
 
 	// Count namespaces in spoke
@@ -55,68 +48,92 @@ func (o *AgentOptions) syncPlacementScore(ctx context.Context, spokeClient kuber
 	}
 	podCount := len(podList.Items)
 
-	// Build AddOnPlacementScore
-	score := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
-			"kind":       "AddOnPlacementScore",
-			"metadata": map[string]interface{}{
-				"name":      PlacementScoreName,
-				"namespace": o.SpokeClusterName,
-			},
-		},
+	nodeList, err := spokeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
 	}
+	capacity := computeClusterCapacity(nodeList.Items, podList.Items)
 
-	// Check if exists
-	existing, err := hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).Get(ctx, PlacementScoreName, metav1.GetOptions{})
-	if err == nil {
-		// Update existing - preserve resourceVersion
-		score.SetResourceVersion(existing.GetResourceVersion())
+	scorers, err := loadScorers(o.PlacementScorersFile)
+	if err != nil {
+		return err
+	}
+	metrics := map[string]float64{
+		MetricNamespaceCount:  float64(namespaceCount),
+		MetricPodCount:        float64(podCount),
+		MetricFreeCPUMillis:   float64(capacity.freeCPUMillis()),
+		MetricFreeMemoryBytes: float64(capacity.freeMemory()),
+		MetricFreePodSlots:    float64(capacity.freePods()),
+		MetricHeadroomRatio:   capacity.headroomRatio(),
+	}
+	for _, scorer := range scorers {
+		if scorer.Metric == MetricFreeStorageBytes {
+			metrics[MetricFreeStorageBytes] = float64(freeStorageBytes(ctx, podList.Items, volumeStats))
+			break
+		}
 	}
 
-	// Set status with scores
-	// OCM requires scores in range [-100, 100]
-	// We normalize: fewer pods/namespaces = higher score (more capacity)
-	// Using inverse: score = 100 - (count * 100 / maxExpected)
-	namespaceScore := normalizeScore(namespaceCount, 50)  // max 50 namespaces expected
-	podScore := normalizeScore(podCount, 200)              // max 200 pods expected
+	scores := smoother.smooth(ctx, computeScores(scorers, metrics))
 
-	now := metav1.Now()
+	// validUntil is set when the scores are written, a buffered write may land much later
 	status := map[string]interface{}{
-		"validUntil": now.Add(SyncInterval * 2).Format("2006-01-02T15:04:05Z"),
-		"scores": []interface{}{
-			map[string]interface{}{
-				"name":  "namespaceCount",
-				"value": int64(namespaceScore),
-			},
-			map[string]interface{}{
-				"name":  "podCount",
-				"value": int64(podScore),
-			},
-		},
+		"scores": scores,
 	}
-	score.Object["status"] = status
+	klog.V(4).Infof("Placement score metrics: %v", metrics)
 
-	// Create or update
-	if existing == nil {
-		_, err = hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).Create(ctx, score, metav1.CreateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to create placement score: %w", err)
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyPlacementScore, PlacementScoreName, payload)
+}
+
+// publishPlacementScore creates/updates the AddOnPlacementScore with the scores
+// in the payload, valid from now until the next sync is overdue.
+func (o *AgentOptions) publishPlacementScore(ctx context.Context, hubDynamicClient dynamic.Interface, payload []byte) error {
+	// util/json keeps integers as int64, as unstructured objects expect
+	status := map[string]interface{}{}
+	if err := utiljson.Unmarshal(payload, &status); err != nil {
+		return fmt.Errorf("failed to decode placement score status: %w", err)
+	}
+
+	scores := hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName)
+
+	// Scores live in status, which is a subresource: it is dropped on create and
+	// can only be written with UpdateStatus on an object that already exists.
+	existing, err := scores.Get(ctx, PlacementScoreName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		score := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
+				"kind":       "AddOnPlacementScore",
+				"metadata": map[string]interface{}{
+					"name":      PlacementScoreName,
+					"namespace": o.SpokeClusterName,
+					"labels": map[string]interface{}{
+						"app": "basic-addon",
+					},
+				},
+			},
 		}
-		klog.Infof("Created AddOnPlacementScore: namespaceCount=%d (score=%d), podCount=%d (score=%d)", namespaceCount, namespaceScore, podCount, podScore)
-	} else {
-		_, err = hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).Update(ctx, score, metav1.UpdateOptions{})
+		existing, err = scores.Create(ctx, score, metav1.CreateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to update placement score: %w", err)
+			return fmt.Errorf("failed to create placement score: %w", err)
 		}
-		klog.Infof("Updated AddOnPlacementScore: namespaceCount=%d (score=%d), podCount=%d (score=%d)", namespaceCount, namespaceScore, podCount, podScore)
+		klog.Infof("Created AddOnPlacementScore %s", PlacementScoreName)
+	} else if err != nil {
+		return fmt.Errorf("failed to get placement score: %w", err)
 	}
 
-	// Update status subresource
-	_, err = hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).UpdateStatus(ctx, score, metav1.UpdateOptions{})
-	if err != nil {
-		klog.V(4).Infof("Failed to update placement score status (may not support status subresource): %v", err)
+	// Update status subresource on the latest version of the object. Valid until
+	// the next sync is overdue, even if one run is missed.
+	status["validUntil"] = metav1.Now().Add(o.maxStrategyInterval(strategyPlacementScore) * 2).UTC().Format(time.RFC3339)
+	score := existing.DeepCopy()
+	score.Object["status"] = status
+	if _, err = scores.UpdateStatus(ctx, score, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update placement score status: %w", err)
 	}
+	klog.Infof("Updated AddOnPlacementScore %s status", PlacementScoreName)
 
 	return nil
 }
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestPublishPlacementScore(t *testing.T) {
+	payload := []byte(`{"scores":[{"name":"podCount","value":80}]}`)
+
+	tests := []struct {
+		name       string
+		existing   []runtime.Object
+		reactor    clienttesting.ReactionFunc
+		wantErr    bool
+		wantVerbs  []string
+		wantScores bool
+	}{
+		{
+			name:       "first run creates the score then sets its status",
+			wantVerbs:  []string{"get", "create", "update"},
+			wantScores: true,
+		},
+		{
+			name:       "existing score only gets its status updated",
+			existing:   []runtime.Object{newPlacementScore("cluster1")},
+			wantVerbs:  []string{"get", "update"},
+			wantScores: true,
+		},
+		{
+			name:     "status update error is reported",
+			existing: []runtime.Object{newPlacementScore("cluster1")},
+			reactor: func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() == "status" {
+					return true, nil, fmt.Errorf("conflict")
+				}
+				return false, nil, nil
+			},
+			wantErr:   true,
+			wantVerbs: []string{"get", "update"},
+		},
+		{
+			name: "get error other than not found is reported",
+			reactor: func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if action.GetVerb() == "get" {
+					return true, nil, fmt.Errorf("hub unreachable")
+				}
+				return false, nil, nil
+			},
+			wantErr:   true,
+			wantVerbs: []string{"get"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{scoreGVR: "AddOnPlacementScoreList"}, tt.existing...)
+			if tt.reactor != nil {
+				client.PrependReactor("*", "addonplacementscores", tt.reactor)
+			}
+			opts := NewAgentOptions("basic-addon")
+			opts.SpokeClusterName = "cluster1"
+
+			err := opts.publishPlacementScore(context.TODO(), client, payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publishPlacementScore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var verbs []string
+			for _, action := range client.Actions() {
+				verbs = append(verbs, action.GetVerb())
+				if action.GetVerb() == "create" {
+					obj := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+					if _, found := obj.Object["status"]; found {
+						t.Error("status should not be sent on create")
+					}
+				}
+			}
+			if strings.Join(verbs, ",") != strings.Join(tt.wantVerbs, ",") {
+				t.Errorf("actions = %v, want %v", verbs, tt.wantVerbs)
+			}
+
+			if !tt.wantScores {
+				return
+			}
+			score, err := client.Resource(scoreGVR).Namespace("cluster1").Get(context.TODO(), PlacementScoreName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get placement score: %v", err)
+			}
+			scores, _, _ := unstructured.NestedSlice(score.Object, "status", "scores")
+			if len(scores) != 1 {
+				t.Errorf("status.scores = %v, want 1 score", scores)
+			}
+			// Valid from the write, not from when the scores were computed
+			validUntil, _, _ := unstructured.NestedString(score.Object, "status", "validUntil")
+			valid, err := time.Parse(time.RFC3339, validUntil)
+			if err != nil {
+				t.Fatalf("status.validUntil = %q: %v", validUntil, err)
+			}
+			if want := time.Now().Add(opts.maxStrategyInterval(strategyPlacementScore)); valid.Before(want) {
+				t.Errorf("status.validUntil = %s, want after %s", valid, want)
+			}
+		})
+	}
+}
+
+func newPlacementScore(namespace string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cluster.open-cluster-management.io/v1alpha1",
+			"kind":       "AddOnPlacementScore",
+			"metadata": map[string]interface{}{
+				"name":            PlacementScoreName,
+				"namespace":       namespace,
+				"resourceVersion": "1",
+			},
+		},
+	}
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// QuotaReportConfigMapName is the ConfigMap with the ResourceQuota utilization of the spoke.
+	QuotaReportConfigMapName = "quota-report"
+
+	// QuotasHealthyConditionType is the addon condition listing the quotas above the threshold.
+	QuotasHealthyConditionType = "QuotasHealthy"
+
+	// DefaultQuotaThreshold is the used/hard ratio above which a quota is flagged.
+	DefaultQuotaThreshold = 0.9
+
+	// maxQuotaReportEntries keeps the report below the ConfigMap size limit.
+	// Flagged quotas are kept first.
+	maxQuotaReportEntries = 1000
+
+	// maxConditionQuotas bounds the quotas named in the QuotasHealthy message.
+	maxConditionQuotas = 5
+)
+
+// QuotaReport is the structure sent to the hub with the ResourceQuota
+// utilization of the spoke and the namespaces left unconstrained.
+type QuotaReport struct {
+	ClusterName string    `json:"clusterName"`
+	Timestamp   time.Time `json:"timestamp"`
+	Threshold   float64   `json:"threshold"`
+	TotalQuotas int       `json:"totalQuotas"`
+	// FlaggedQuotas counts the quotas with a resource above the threshold.
+	FlaggedQuotas int `json:"flaggedQuotas"`
+	// Truncated is set when quotas were left out of the report.
+	Truncated bool        `json:"truncated,omitempty"`
+	Quotas    []QuotaInfo `json:"quotas"`
+	// NamespacesWithoutQuota and NamespacesWithoutLimitRange are the active
+	// namespaces without any ResourceQuota or LimitRange.
+	NamespacesWithoutQuota      []string `json:"namespacesWithoutQuota"`
+	NamespacesWithoutLimitRange []string `json:"namespacesWithoutLimitRange"`
+}
+
+// QuotaInfo is the utilization of a ResourceQuota.
+type QuotaInfo struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Resources []QuotaResource `json:"resources"`
+	// MaxRatio is the highest used/hard ratio among the resources.
+	MaxRatio float64 `json:"maxRatio"`
+	Flagged  bool    `json:"flagged,omitempty"`
+}
+
+// QuotaResource is the usage of a resource limited by a ResourceQuota.
+type QuotaResource struct {
+	Resource string  `json:"resource"`
+	Used     string  `json:"used"`
+	Hard     string  `json:"hard"`
+	Ratio    float64 `json:"ratio"`
+	Flagged  bool    `json:"flagged,omitempty"`
+}
+
+// syncQuotaReport collects the ResourceQuotas and LimitRanges of the spoke,
+// sends the quota report to the hub and sets the QuotasHealthy condition of the addon.
+func (o *AgentOptions) syncQuotaReport(ctx context.Context, spokeClient kubernetes.Interface, outbox *outbox) error {
+	klog.V(4).Info("Syncing quota report")
+
+	namespaces, err := spokeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	quotas, err := spokeClient.CoreV1().ResourceQuotas(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+	limitRanges, err := spokeClient.CoreV1().LimitRanges(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list limit ranges: %w", err)
+	}
+
+	report := buildQuotaReport(o.SpokeClusterName, namespaces.Items, quotas.Items, limitRanges.Items, o.QuotaThreshold)
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := outbox.publish(ctx, strategyQuotaReport, QuotaReportConfigMapName, reportJSON); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(quotasHealthyCondition(report))
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyAddonStatus, QuotasHealthyConditionType, payload)
+}
+
+// publishQuotaReport creates or updates the quota report ConfigMap in hub.
+func (o *AgentOptions) publishQuotaReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, QuotaReportConfigMapName, reportJSON)
+}
+
+// buildQuotaReport computes the used/hard ratio of each resource of the
+// quotas, flagging the ones above threshold, and finds the active namespaces
+// without quotas or LimitRanges.
+func buildQuotaReport(clusterName string, namespaces []corev1.Namespace, quotas []corev1.ResourceQuota,
+	limitRanges []corev1.LimitRange, threshold float64) QuotaReport {
+	report := QuotaReport{
+		ClusterName: clusterName,
+		Timestamp:   time.Now().UTC(),
+		Threshold:   threshold,
+		TotalQuotas: len(quotas),
+		Quotas:      make([]QuotaInfo, 0, len(quotas)),
+	}
+
+	withQuota := sets.New[string]()
+	for _, quota := range quotas {
+		withQuota.Insert(quota.Namespace)
+		info := QuotaInfo{Namespace: quota.Namespace, Name: quota.Name, Resources: []QuotaResource{}}
+		for name, hard := range quota.Status.Hard {
+			used := quota.Status.Used[name]
+			resource := QuotaResource{
+				Resource: string(name),
+				Used:     used.String(),
+				Hard:     hard.String(),
+				Ratio:    quotaRatio(used.AsApproximateFloat64(), hard.AsApproximateFloat64()),
+			}
+			resource.Flagged = resource.Ratio >= threshold
+			info.Flagged = info.Flagged || resource.Flagged
+			info.MaxRatio = max(info.MaxRatio, resource.Ratio)
+			info.Resources = append(info.Resources, resource)
+		}
+		sort.Slice(info.Resources, func(i, j int) bool {
+			return info.Resources[i].Resource < info.Resources[j].Resource
+		})
+		if info.Flagged {
+			report.FlaggedQuotas++
+		}
+		report.Quotas = append(report.Quotas, info)
+	}
+
+	// Most utilized first, so flagged quotas are kept when the report is truncated
+	sort.Slice(report.Quotas, func(i, j int) bool {
+		a, b := report.Quotas[i], report.Quotas[j]
+		if a.MaxRatio != b.MaxRatio {
+			return a.MaxRatio > b.MaxRatio
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	if len(report.Quotas) > maxQuotaReportEntries {
+		report.Quotas = report.Quotas[:maxQuotaReportEntries]
+		report.Truncated = true
+	}
+
+	withLimitRange := sets.New[string]()
+	for _, limitRange := range limitRanges {
+		withLimitRange.Insert(limitRange.Namespace)
+	}
+	report.NamespacesWithoutQuota = []string{}
+	report.NamespacesWithoutLimitRange = []string{}
+	for _, namespace := range namespaces {
+		if namespace.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		if !withQuota.Has(namespace.Name) {
+			report.NamespacesWithoutQuota = append(report.NamespacesWithoutQuota, namespace.Name)
+		}
+		if !withLimitRange.Has(namespace.Name) {
+			report.NamespacesWithoutLimitRange = append(report.NamespacesWithoutLimitRange, namespace.Name)
+		}
+	}
+	sort.Strings(report.NamespacesWithoutQuota)
+	sort.Strings(report.NamespacesWithoutLimitRange)
+	return report
+}
+
+// quotaRatio returns used/hard, rounded to three decimals. A resource with a
+// hard limit of zero is only at its limit once something uses it.
+func quotaRatio(used, hard float64) float64 {
+	if hard <= 0 {
+		if used > 0 {
+			return 1
+		}
+		return 0
+	}
+	return math.Round(used/hard*1000) / 1000
+}
+
+// quotasHealthyCondition returns the QuotasHealthy condition summarizing the
+// quota report: quotas are healthy when no resource is above the threshold.
+func quotasHealthyCondition(report QuotaReport) map[string]interface{} {
+	status := metav1.ConditionTrue
+	reason := "QuotasBelowThreshold"
+	message := fmt.Sprintf("%d quotas below %.0f%% utilization", report.TotalQuotas, report.Threshold*100)
+	if report.FlaggedQuotas > 0 {
+		var offenders []string
+		for _, quota := range report.Quotas {
+			if !quota.Flagged {
+				continue
+			}
+			var resources []string
+			for _, resource := range quota.Resources {
+				if resource.Flagged {
+					resources = append(resources, fmt.Sprintf("%s %.0f%%", resource.Resource, resource.Ratio*100))
+				}
+			}
+			offenders = append(offenders, fmt.Sprintf("%s/%s (%s)", quota.Namespace, quota.Name, strings.Join(resources, ", ")))
+		}
+		status = metav1.ConditionFalse
+		reason = "QuotaUtilizationHigh"
+		message = fmt.Sprintf("%d/%d quotas at or above %.0f%% utilization: %s",
+			report.FlaggedQuotas, report.TotalQuotas, report.Threshold*100, truncatedList(offenders, maxConditionQuotas))
+	}
+	if len(report.NamespacesWithoutQuota) > 0 {
+		message += fmt.Sprintf("; %d namespaces without quota", len(report.NamespacesWithoutQuota))
+	}
+
+	return map[string]interface{}{
+		"type":               QuotasHealthyConditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": metav1.Now().Format("2006-01-02T15:04:05Z"),
+	}
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildQuotaReport(t *testing.T) {
+	quota := func(namespace, name string, hard, used corev1.ResourceList) corev1.ResourceQuota {
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	namespace := func(name string, phase corev1.NamespacePhase) corev1.Namespace {
+		return corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.NamespaceStatus{Phase: phase}}
+	}
+	namespaces := []corev1.Namespace{
+		namespace("team-a", corev1.NamespaceActive), namespace("team-b", corev1.NamespaceActive),
+		namespace("sandbox", corev1.NamespaceActive), namespace("leaving", corev1.NamespaceTerminating),
+	}
+	quotas := []corev1.ResourceQuota{
+		quota("team-b", "compute",
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("4"), corev1.ResourceRequestsMemory: resource.MustParse("8Gi")},
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1"), corev1.ResourceRequestsMemory: resource.MustParse("2Gi")}),
+		quota("team-a", "compute",
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2"), corev1.ResourcePods: resource.MustParse("10")},
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1900m"), corev1.ResourcePods: resource.MustParse("3")}),
+		// A hard limit of zero forbids the resource, it isn't full
+		quota("team-a", "no-lb", corev1.ResourceList{corev1.ResourceServicesLoadBalancers: resource.MustParse("0")}, nil),
+	}
+	limitRanges := []corev1.LimitRange{{ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "team-a"}}}
+
+	report := buildQuotaReport("cluster1", namespaces, quotas, limitRanges, 0.9)
+
+	if report.TotalQuotas != 3 || report.FlaggedQuotas != 1 {
+		t.Errorf("TotalQuotas = %d, FlaggedQuotas = %d, want 3 and 1", report.TotalQuotas, report.FlaggedQuotas)
+	}
+	wantTeamA := QuotaInfo{Namespace: "team-a", Name: "compute", MaxRatio: 0.95, Flagged: true, Resources: []QuotaResource{
+		{Resource: "pods", Used: "3", Hard: "10", Ratio: 0.3},
+		{Resource: "requests.cpu", Used: "1900m", Hard: "2", Ratio: 0.95, Flagged: true},
+	}}
+	if !reflect.DeepEqual(report.Quotas[0], wantTeamA) {
+		t.Errorf("Quotas[0] = %+v, want %+v", report.Quotas[0], wantTeamA)
+	}
+	if report.Quotas[1].Name != "compute" || report.Quotas[1].Flagged || report.Quotas[2].Name != "no-lb" || report.Quotas[2].Flagged {
+		t.Errorf("unexpected quotas %+v", report.Quotas[1:])
+	}
+	if want := []string{"sandbox"}; !reflect.DeepEqual(report.NamespacesWithoutQuota, want) {
+		t.Errorf("NamespacesWithoutQuota = %v, want %v", report.NamespacesWithoutQuota, want)
+	}
+	if want := []string{"sandbox", "team-b"}; !reflect.DeepEqual(report.NamespacesWithoutLimitRange, want) {
+		t.Errorf("NamespacesWithoutLimitRange = %v, want %v", report.NamespacesWithoutLimitRange, want)
+	}
+
+	condition := quotasHealthyCondition(report)
+	wantMessage := "1/3 quotas at or above 90% utilization: team-a/compute (requests.cpu 95%); 1 namespaces without quota"
+	if condition["status"] != "False" || condition["reason"] != "QuotaUtilizationHigh" || condition["message"] != wantMessage {
+		t.Errorf("unexpected condition %v", condition)
+	}
+	if condition := quotasHealthyCondition(buildQuotaReport("cluster1", nil, quotas, nil, 0.99)); condition["status"] != "True" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+}
+
+func TestSyncQuotaReport(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "team-a"},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+				Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+			},
+		},
+	)
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyQuotaReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishQuotaReport(ctx, hubClient, payload)
+	})
+	var condition map[string]interface{}
+	b.register(strategyAddonStatus, func(ctx context.Context, payload []byte) error {
+		return json.Unmarshal(payload, &condition)
+	})
+
+	if err := opts.syncQuotaReport(context.TODO(), spokeClient, b); err != nil {
+		t.Fatalf("syncQuotaReport() error = %v", err)
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), QuotaReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("quota report was not published: %v", err)
+	}
+	report := QuotaReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalQuotas != 1 || report.FlaggedQuotas != 1 || report.Threshold != DefaultQuotaThreshold ||
+		!reflect.DeepEqual(report.NamespacesWithoutLimitRange, []string{"team-a"}) {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if condition["type"] != QuotasHealthyConditionType || condition["status"] != "False" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// WorkloadsHealthyConditionType is the addon condition listing the
+	// workloads with crashing or restarting containers.
+	WorkloadsHealthyConditionType = "WorkloadsHealthy"
+
+	// DefaultRestartThreshold is the number of restarts of a container within
+	// DefaultRestartWindow that flags it.
+	DefaultRestartThreshold = 5
+	DefaultRestartWindow    = time.Hour
+
+	// maxConditionOffenders bounds the workloads named in the WorkloadsHealthy message.
+	maxConditionOffenders = 5
+)
+
+// anomalousWaitingReasons are the waiting reasons that flag a container, whatever its restarts.
+var anomalousWaitingReasons = sets.New("CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull")
+
+// restartSample is the restart count of a container when it was observed.
+type restartSample struct {
+	at    time.Time
+	count int32
+}
+
+// restartTracker keeps the restart counts of the containers observed within
+// the window, to tell containers restarting now from containers that
+// restarted long ago.
+type restartTracker struct {
+	threshold int32
+	window    time.Duration
+	now       func() time.Time
+
+	lock    sync.Mutex
+	samples map[string][]restartSample
+}
+
+func newRestartTracker(threshold int32, window time.Duration) *restartTracker {
+	return &restartTracker{
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+		samples:   map[string][]restartSample{},
+	}
+}
+
+// workloadAnomaly aggregates the anomalies of a container across the pods of a workload.
+type workloadAnomaly struct {
+	workload  string
+	container string
+	reasons   sets.Set[string]
+	restarts  int32
+	pods      int
+}
+
+func (a *workloadAnomaly) String() string {
+	details := sets.List(a.reasons)
+	if a.restarts > 0 {
+		details = append(details, fmt.Sprintf("%d restarts", a.restarts))
+	}
+	description := fmt.Sprintf("%s container %s (%s", a.workload, a.container, strings.Join(details, ", "))
+	if a.pods > 1 {
+		description += fmt.Sprintf(", %d pods", a.pods)
+	}
+	return description + ")"
+}
+
+// observe records the restart counts of the containers of the pods and
+// returns the anomalies of the workloads, the most restarted first. Init
+// containers are tracked like the others, since a crash looping init container
+// blocks the pod just the same. A container is anomalous when it restarted at least threshold times within
+// the window, is waiting in CrashLoopBackOff or on an image pull error, or was
+// OOMKilled within the window.
+func (t *restartTracker) observe(pods []corev1.Pod) []*workloadAnomaly {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	windowStart := now.Add(-t.window)
+	observed := sets.New[string]()
+	anomalies := map[string]*workloadAnomaly{}
+
+	for _, pod := range pods {
+		workload := podWorkload(&pod)
+		for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+			key := fmt.Sprintf("%s/%s", pod.UID, status.Name)
+			observed.Insert(key)
+
+			// The newest sample from before the window is the baseline, older ones no longer count
+			samples := append(t.samples[key], restartSample{at: now, count: status.RestartCount})
+			for len(samples) > 1 && !samples[1].at.After(windowStart) {
+				samples = samples[1:]
+			}
+			t.samples[key] = samples
+
+			reasons := sets.New[string]()
+			restarts := samples[len(samples)-1].count - samples[0].count
+			if restarts >= t.threshold {
+				reasons.Insert("RestartThresholdExceeded")
+			}
+			if status.State.Waiting != nil && anomalousWaitingReasons.Has(status.State.Waiting.Reason) {
+				reasons.Insert(status.State.Waiting.Reason)
+			}
+			if oomKilledSince(status, windowStart) {
+				reasons.Insert("OOMKilled")
+			}
+			if reasons.Len() == 0 {
+				continue
+			}
+
+			anomalyKey := workload + "/" + status.Name
+			anomaly, ok := anomalies[anomalyKey]
+			if !ok {
+				anomaly = &workloadAnomaly{workload: workload, container: status.Name, reasons: sets.New[string]()}
+				anomalies[anomalyKey] = anomaly
+			}
+			anomaly.reasons = anomaly.reasons.Union(reasons)
+			anomaly.restarts += restarts
+			anomaly.pods++
+		}
+	}
+
+	// Forget the containers of deleted pods
+	for key := range t.samples {
+		if !observed.Has(key) {
+			delete(t.samples, key)
+		}
+	}
+
+	result := make([]*workloadAnomaly, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		result = append(result, anomaly)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].restarts != result[j].restarts {
+			return result[i].restarts > result[j].restarts
+		}
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// oomKilledSince returns whether the container was OOMKilled after the given time.
+func oomKilledSince(status corev1.ContainerStatus, since time.Time) bool {
+	for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+		if terminated != nil && terminated.Reason == "OOMKilled" && !terminated.FinishedAt.Time.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadsHealthyCondition returns the WorkloadsHealthy condition listing the top offenders.
+func (t *restartTracker) workloadsHealthyCondition(anomalies []*workloadAnomaly) map[string]interface{} {
+	status := metav1.ConditionTrue
+	reason := "NoContainerAnomalies"
+	message := fmt.Sprintf("No container is crash looping, failing to pull its image, OOMKilled or restarted %d times in %s",
+		t.threshold, t.window)
+	if len(anomalies) > 0 {
+		offenders := make([]string, 0, maxConditionOffenders)
+		for _, anomaly := range anomalies[:min(len(anomalies), maxConditionOffenders)] {
+			offenders = append(offenders, anomaly.String())
+		}
+		status = metav1.ConditionFalse
+		reason = "ContainerAnomalies"
+		message = fmt.Sprintf("%d containers with anomalies in the last %s, top offenders: %s",
+			len(anomalies), t.window, strings.Join(offenders, "; "))
+	}
+
+	return map[string]interface{}{
+		"type":               WorkloadsHealthyConditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": metav1.Now().Format("2006-01-02T15:04:05Z"),
+	}
+}
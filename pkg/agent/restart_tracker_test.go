@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestartTracker(t *testing.T) {
+	isController := true
+	replicaSet := []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d9f8c7b6", Controller: &isController}}
+	pod := func(uid, name string, restarts int32, state corev1.ContainerState) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid), Name: name, Namespace: "default",
+				Labels: map[string]string{"pod-template-hash": "5d9f8c7b6"}, OwnerReferences: replicaSet},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "app", RestartCount: restarts, State: state}}},
+		}
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	crashLooping := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newRestartTracker(3, time.Hour)
+	tracker.now = func() time.Time { return now }
+
+	// Restarts from before the first observation don't count
+	if anomalies := tracker.observe([]corev1.Pod{pod("a", "web-1", 10, running)}); len(anomalies) != 0 {
+		t.Errorf("anomalies = %v, want none", anomalies)
+	}
+
+	now = now.Add(30 * time.Minute)
+	anomalies := tracker.observe([]corev1.Pod{pod("a", "web-1", 13, running), pod("b", "web-2", 0, crashLooping)})
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %v, want 1", anomalies)
+	}
+	want := "Deployment/default/web container app (CrashLoopBackOff, RestartThresholdExceeded, 3 restarts, 2 pods)"
+	if anomalies[0].String() != want {
+		t.Errorf("anomaly = %q, want %q", anomalies[0], want)
+	}
+
+	// The restarts leave the window
+	now = now.Add(time.Hour)
+	if anomalies := tracker.observe([]corev1.Pod{pod("a", "web-1", 13, running)}); len(anomalies) != 0 {
+		t.Errorf("anomalies = %v, want none", anomalies)
+	}
+	if _, ok := tracker.samples["b/app"]; ok {
+		t.Error("samples of the deleted pod were not forgotten")
+	}
+
+	// OOMKilled within the window
+	oomKilled := pod("a", "web-1", 14, running)
+	oomKilled.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{
+		Reason: "OOMKilled", FinishedAt: metav1.NewTime(now.Add(-time.Minute)),
+	}
+	anomalies = tracker.observe([]corev1.Pod{oomKilled})
+	if len(anomalies) != 1 || !anomalies[0].reasons.Has("OOMKilled") || anomalies[0].restarts != 1 {
+		t.Errorf("anomalies = %v, want OOMKilled with 1 restart", anomalies)
+	}
+
+	// Crash looping init containers are anomalies too
+	initCrashLooping := pod("c", "web-3", 0, running)
+	initCrashLooping.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: "migrate", State: crashLooping}}
+	initAnomalies := tracker.observe([]corev1.Pod{initCrashLooping})
+	if len(initAnomalies) != 1 || initAnomalies[0].container != "migrate" || !initAnomalies[0].reasons.Has("CrashLoopBackOff") {
+		t.Errorf("anomalies = %v, want the crash looping init container", initAnomalies)
+	}
+
+	condition := tracker.workloadsHealthyCondition(anomalies)
+	if condition["type"] != WorkloadsHealthyConditionType || condition["status"] != "False" || condition["reason"] != "ContainerAnomalies" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+	if condition := tracker.workloadsHealthyCondition(nil); condition["status"] != "True" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+}
+
+func TestSyncAddonStatusWorkloadsHealthy(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "shell",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}}},
+	})
+	opts := NewAgentOptions("basic-addon")
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditions := map[string]map[string]interface{}{}
+	b.register(strategyAddonStatus, func(ctx context.Context, payload []byte) error {
+		condition := map[string]interface{}{}
+		if err := json.Unmarshal(payload, &condition); err != nil {
+			return err
+		}
+		conditions[condition["type"].(string)] = condition
+		return nil
+	})
+
+	tracker := newRestartTracker(opts.RestartThreshold, opts.RestartWindow)
+	if err := opts.syncAddonStatus(context.TODO(), spokeClient, tracker, b); err != nil {
+		t.Fatalf("syncAddonStatus() error = %v", err)
+	}
+
+	condition := conditions[WorkloadsHealthyConditionType]
+	if condition["status"] != "False" ||
+		!strings.Contains(condition["message"].(string), "Pod/default/debug container shell (ImagePullBackOff)") {
+		t.Errorf("unexpected condition %v", condition)
+	}
+	if _, ok := conditions["PodCountHealthy"]; !ok {
+		t.Error("PodCountHealthy condition was not published")
+	}
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Causes of pending pods, summarized per cluster in the pod report.
+const (
+	SchedulingCauseInsufficientCPU    = "InsufficientCPU"
+	SchedulingCauseInsufficientMemory = "InsufficientMemory"
+	SchedulingCauseInsufficientOther  = "InsufficientResources"
+	SchedulingCauseTaints             = "UntoleratedTaints"
+	SchedulingCauseNodeAffinity       = "NodeAffinity"
+	SchedulingCausePodAffinity        = "PodAffinity"
+	SchedulingCauseTopologySpread     = "TopologySpread"
+	SchedulingCauseUnschedulableNodes = "UnschedulableNodes"
+	SchedulingCauseNodePorts          = "NodePorts"
+	SchedulingCauseTooManyPods        = "TooManyPods"
+	SchedulingCausePVCUnbound         = "PVCUnbound"
+	SchedulingCauseVolumeNodeAffinity = "VolumeNodeAffinity"
+	SchedulingCauseOther              = "Other"
+
+	// failedSchedulingReason is the reason of the events the scheduler emits for pods it can't place.
+	failedSchedulingReason = "FailedScheduling"
+)
+
+// schedulingCausePatterns map fragments of the scheduler messages to causes.
+// The scheduler explains why each group of nodes was filtered out, as in
+// "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had untolerated taint {...}".
+var schedulingCausePatterns = []struct {
+	fragment string
+	cause    string
+}{
+	{"insufficient cpu", SchedulingCauseInsufficientCPU},
+	{"insufficient memory", SchedulingCauseInsufficientMemory},
+	{"insufficient ", SchedulingCauseInsufficientOther},
+	{"untolerated taint", SchedulingCauseTaints},
+	{"had taint", SchedulingCauseTaints},
+	{"node affinity/selector", SchedulingCauseNodeAffinity},
+	{"pod affinity", SchedulingCausePodAffinity},
+	{"pod anti-affinity", SchedulingCausePodAffinity},
+	{"topology spread constraints", SchedulingCauseTopologySpread},
+	{"were unschedulable", SchedulingCauseUnschedulableNodes},
+	{"free ports", SchedulingCauseNodePorts},
+	{"too many pods", SchedulingCauseTooManyPods},
+	{"unbound immediate persistentvolumeclaims", SchedulingCausePVCUnbound},
+	{"persistentvolumeclaim", SchedulingCausePVCUnbound},
+	{"volume node affinity conflict", SchedulingCauseVolumeNodeAffinity},
+}
+
+// SchedulingInfo explains why a pending pod is not scheduled.
+type SchedulingInfo struct {
+	// Reason and Message are from the PodScheduled condition of the pod.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Causes are the causes found in the condition and event messages.
+	Causes []string `json:"causes"`
+	// FailedSchedulingEvents counts the FailedScheduling events of the pod,
+	// LastEventMessage is the message of the most recent one.
+	FailedSchedulingEvents int32      `json:"failedSchedulingEvents,omitempty"`
+	LastEventMessage       string     `json:"lastEventMessage,omitempty"`
+	LastEventTime          *time.Time `json:"lastEventTime,omitempty"`
+}
+
+// schedulingInfo returns why the pod is pending, or nil when the pod is not
+// waiting to be scheduled.
+func schedulingInfo(pod *corev1.Pod, events []corev1.Event) *SchedulingInfo {
+	if pod.Status.Phase != corev1.PodPending || len(pod.Spec.NodeName) > 0 {
+		return nil
+	}
+
+	info := &SchedulingInfo{}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status != corev1.ConditionTrue {
+			info.Reason = condition.Reason
+			info.Message = condition.Message
+		}
+	}
+	for _, event := range events {
+		info.FailedSchedulingEvents += eventCount(event)
+		if _, last := eventTimes(event); info.LastEventTime == nil || !last.Before(*info.LastEventTime) {
+			info.LastEventMessage = event.Message
+			info.LastEventTime = &last
+		}
+	}
+
+	info.Causes = schedulingCauses(info.Message, info.LastEventMessage)
+	return info
+}
+
+// schedulingCauses returns the causes found in the scheduler messages. A
+// message without a known cause is reported as Other.
+func schedulingCauses(messages ...string) []string {
+	causes := []string{}
+	found := map[string]bool{}
+	for _, message := range messages {
+		if len(message) == 0 {
+			continue
+		}
+		matched := false
+		lower := strings.ToLower(message)
+		for _, pattern := range schedulingCausePatterns {
+			if !strings.Contains(lower, pattern.fragment) {
+				continue
+			}
+			matched = true
+			// "insufficient " also matches cpu and memory
+			if pattern.cause == SchedulingCauseInsufficientOther && !hasOtherInsufficientResource(lower) {
+				continue
+			}
+			if !found[pattern.cause] {
+				found[pattern.cause] = true
+				causes = append(causes, pattern.cause)
+			}
+		}
+		if !matched && !found[SchedulingCauseOther] {
+			found[SchedulingCauseOther] = true
+			causes = append(causes, SchedulingCauseOther)
+		}
+	}
+	sort.Strings(causes)
+	return causes
+}
+
+// hasOtherInsufficientResource returns whether a lowercase scheduler message
+// reports a resource other than cpu and memory as insufficient, like
+// ephemeral-storage or an extended resource.
+func hasOtherInsufficientResource(message string) bool {
+	for _, part := range strings.Split(message, "insufficient ")[1:] {
+		if !strings.HasPrefix(part, "cpu") && !strings.HasPrefix(part, "memory") {
+			return true
+		}
+	}
+	return false
+}
+
+// failedSchedulingEvents groups the FailedScheduling events by the pod they involve.
+func failedSchedulingEvents(events []corev1.Event) map[types.NamespacedName][]corev1.Event {
+	byPod := map[types.NamespacedName][]corev1.Event{}
+	for _, event := range events {
+		if event.Reason != failedSchedulingReason || event.InvolvedObject.Kind != "Pod" {
+			continue
+		}
+		key := types.NamespacedName{Namespace: event.InvolvedObject.Namespace, Name: event.InvolvedObject.Name}
+		byPod[key] = append(byPod[key], event)
+	}
+	return byPod
+}
+
+// podEvents returns the events of the pod, leaving out the events of an
+// earlier pod with the same name.
+func podEvents(pod *corev1.Pod, byPod map[types.NamespacedName][]corev1.Event) []corev1.Event {
+	var events []corev1.Event
+	for _, event := range byPod[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] {
+		if len(event.InvolvedObject.UID) == 0 || event.InvolvedObject.UID == pod.UID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildPodReportScheduling(t *testing.T) {
+	pending := func(name, message string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{{
+					Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: message,
+				}},
+			},
+		}
+	}
+	event := func(pod, uid, message string, count int32, last time.Time) corev1.Event {
+		return corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod, UID: types.UID(uid)},
+			Reason:         "FailedScheduling",
+			Message:        message,
+			Count:          count,
+			LastTimestamp:  metav1.NewTime(last),
+		}
+	}
+	resources := "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had untolerated taint {node-role.kubernetes.io/control-plane: }."
+	pvc := "0/3 nodes are available: pod has unbound immediate PersistentVolumeClaims."
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pulling := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pulling", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	pods := []corev1.Pod{pending("web", resources), pending("db", ""), pending("gpu", "0/3 nodes are available: 3 Insufficient nvidia.com/gpu."), pulling}
+	events := []corev1.Event{
+		event("web", "web", "0/3 nodes are available: 3 Insufficient memory.", 2, now.Add(-time.Minute)),
+		event("web", "web", resources, 3, now),
+		event("db", "db", pvc, 1, now),
+		// Events of an earlier pod with the same name
+		event("db", "old-db", "0/3 nodes are available: 3 node(s) didn't match Pod's node affinity/selector.", 1, now),
+	}
+
+	report := buildPodReport("cluster1", pods, events)
+
+	if report.PendingPods != 3 {
+		t.Errorf("PendingPods = %d, want 3", report.PendingPods)
+	}
+	wantCauses := map[string]int{
+		SchedulingCauseInsufficientCPU:   1,
+		SchedulingCauseTaints:            1,
+		SchedulingCausePVCUnbound:        1,
+		SchedulingCauseInsufficientOther: 1,
+	}
+	if !reflect.DeepEqual(report.SchedulingCauses, wantCauses) {
+		t.Errorf("SchedulingCauses = %v, want %v", report.SchedulingCauses, wantCauses)
+	}
+
+	web := report.Pods[0].Scheduling
+	if web == nil || web.Reason != "Unschedulable" || web.FailedSchedulingEvents != 5 ||
+		web.LastEventMessage != resources || !web.LastEventTime.Equal(now) {
+		t.Errorf("unexpected scheduling of web %+v", web)
+	}
+	if db := report.Pods[1].Scheduling; db == nil || db.FailedSchedulingEvents != 1 ||
+		!reflect.DeepEqual(db.Causes, []string{SchedulingCausePVCUnbound}) {
+		t.Errorf("unexpected scheduling of db %+v", db)
+	}
+	if report.Pods[3].Scheduling != nil {
+		t.Errorf("scheduled pod has scheduling info %+v", report.Pods[3].Scheduling)
+	}
+}
+
+func TestSchedulingCauses(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"0/5 nodes are available: 2 Insufficient cpu, 3 Insufficient memory.",
+			[]string{SchedulingCauseInsufficientCPU, SchedulingCauseInsufficientMemory}},
+		{"0/2 nodes are available: 1 node(s) were unschedulable, 1 node(s) didn't have free ports for the requested pod ports.",
+			[]string{SchedulingCauseNodePorts, SchedulingCauseUnschedulableNodes}},
+		{"0/2 nodes are available: 2 node(s) had volume node affinity conflict.", []string{SchedulingCauseVolumeNodeAffinity}},
+		{"0/2 nodes are available: 2 node(s) didn't match pod topology spread constraints.", []string{SchedulingCauseTopologySpread}},
+		{"something the scheduler never said", []string{SchedulingCauseOther}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := schedulingCauses(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("schedulingCauses(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestSyncPodReportScheduling(t *testing.T) {
+	spokeClient := kubefake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web"},
+			Reason:         "FailedScheduling",
+			Message:        "0/1 nodes are available: 1 Insufficient cpu.",
+			Count:          2,
+		},
+	)
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyPodReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishPodReport(ctx, hubClient, payload)
+	})
+
+	if err := opts.syncPodReport(context.TODO(), spokeClient, b); err != nil {
+		t.Fatalf("syncPodReport() error = %v", err)
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), PodReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("pod report was not published: %v", err)
+	}
+	report := PodReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.PendingPods != 1 || report.SchedulingCauses[SchedulingCauseInsufficientCPU] != 1 ||
+		report.Pods[0].Scheduling.FailedSchedulingEvents != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultPlacementScoreSmoothing publishes raw scores, without smoothing.
+	DefaultPlacementScoreSmoothing = 1.0
+	// DefaultPlacementScoreHysteresis publishes every score change.
+	DefaultPlacementScoreHysteresis = 0
+)
+
+// lastScoresFunc returns the scores published last, or nil if none were.
+type lastScoresFunc func(ctx context.Context) ([]interface{}, error)
+
+// scoreSmoother damps placement score swings, e.g. during rollouts, so
+// Placement decisions don't flap. Each score is smoothed with an exponentially
+// weighted moving average, and the published score only changes when the
+// smoothed one moves at least hysteresis points away from it. The state is kept
+// in memory and seeded from the last published scores after a restart.
+type scoreSmoother struct {
+	// alpha is the weight of the newest value, in (0, 1]. 1 disables smoothing.
+	alpha      float64
+	hysteresis int64
+	lastScores lastScoresFunc
+
+	lock      sync.Mutex
+	restored  bool
+	smoothed  map[string]float64
+	published map[string]int64
+}
+
+func newScoreSmoother(alpha float64, hysteresis int64, lastScores lastScoresFunc) *scoreSmoother {
+	return &scoreSmoother{
+		alpha:      alpha,
+		hysteresis: hysteresis,
+		lastScores: lastScores,
+		smoothed:   map[string]float64{},
+		published:  map[string]int64{},
+	}
+}
+
+// enabled returns whether the smoother changes the scores at all.
+func (s *scoreSmoother) enabled() bool {
+	return s.alpha < 1 || s.hysteresis > 0
+}
+
+// smooth returns the scores to publish for the raw scores computed this cycle.
+// The first call restores the state from the last published scores. If they
+// can't be read, e.g. during a hub outage, smoothing starts unseeded rather
+// than holding back the scores.
+func (s *scoreSmoother) smooth(ctx context.Context, scores []interface{}) []interface{} {
+	if !s.enabled() {
+		return scores
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.restored {
+		last, err := s.lastScores(ctx)
+		if err != nil {
+			klog.Warningf("Failed to restore last placement scores, smoothing from the current ones: %v", err)
+		}
+		for name, value := range scoreValues(last) {
+			s.smoothed[name] = float64(value)
+			s.published[name] = value
+		}
+		s.restored = true
+		klog.V(2).Infof("Restored %d placement scores to smooth from", len(s.published))
+	}
+
+	result := []interface{}{}
+	raw := scoreValues(scores)
+	for name, value := range raw {
+		smoothed := float64(value)
+		if previous, ok := s.smoothed[name]; ok {
+			smoothed = s.alpha*float64(value) + (1-s.alpha)*previous
+		}
+		s.smoothed[name] = smoothed
+
+		candidate := clampScore(math.Round(smoothed))
+		if published, ok := s.published[name]; !ok || abs(candidate-published) >= s.hysteresis {
+			s.published[name] = candidate
+		}
+	}
+	// Keep the order of the raw scores and drop scores no longer configured
+	for _, score := range scores {
+		name, _ := score.(map[string]interface{})["name"].(string)
+		result = append(result, map[string]interface{}{"name": name, "value": s.published[name]})
+	}
+	for name := range s.published {
+		if _, ok := raw[name]; !ok {
+			delete(s.published, name)
+			delete(s.smoothed, name)
+		}
+	}
+	return result
+}
+
+// lastPublishedScores returns the latest placement scores sent to the hub:
+// the one still buffered in the outbox if any, or else the one on the hub.
+func (o *AgentOptions) lastPublishedScores(ctx context.Context, hubDynamicClient dynamic.Interface,
+	outbox *outbox) ([]interface{}, error) {
+	if payload, ok := outbox.pendingPayload(strategyPlacementScore, PlacementScoreName); ok {
+		status := map[string]interface{}{}
+		if err := utiljson.Unmarshal(payload, &status); err != nil {
+			return nil, err
+		}
+		scores, _ := status["scores"].([]interface{})
+		return scores, nil
+	}
+
+	score, err := hubDynamicClient.Resource(scoreGVR).Namespace(o.SpokeClusterName).Get(ctx, PlacementScoreName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scores, _, err := unstructured.NestedSlice(score.Object, "status", "scores")
+	return scores, err
+}
+
+// scoreValues maps score names to values.
+func scoreValues(scores []interface{}) map[string]int64 {
+	values := map[string]int64{}
+	for _, score := range scores {
+		fields, ok := score.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fields["name"].(string)
+		switch value := fields["value"].(type) {
+		case int64:
+			values[name] = value
+		case float64:
+			values[name] = int64(value)
+		}
+	}
+	return values
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
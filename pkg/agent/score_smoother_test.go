@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestScoreSmoother(t *testing.T) {
+	scores := func(values ...int64) []interface{} {
+		result := []interface{}{}
+		for i, value := range values {
+			result = append(result, map[string]interface{}{"name": fmt.Sprintf("score%d", i), "value": value})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		alpha      float64
+		hysteresis int64
+		last       []interface{}
+		raw        [][]interface{}
+		want       []int64
+	}{
+		{
+			name:  "disabled publishes raw scores",
+			alpha: 1,
+			raw:   [][]interface{}{scores(100), scores(-100), scores(40)},
+			want:  []int64{100, -100, 40},
+		},
+		{
+			name:  "ewma damps a swing",
+			alpha: 0.5,
+			raw:   [][]interface{}{scores(100), scores(-100), scores(-100)},
+			want:  []int64{100, 0, -50},
+		},
+		{
+			name:       "hysteresis ignores small changes",
+			alpha:      1,
+			hysteresis: 10,
+			raw:        [][]interface{}{scores(50), scores(55), scores(41), scores(40)},
+			want:       []int64{50, 50, 50, 40},
+		},
+		{
+			name:  "state is restored from the last published score",
+			alpha: 0.5,
+			last:  scores(100),
+			raw:   [][]interface{}{scores(0)},
+			want:  []int64{50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smoother := newScoreSmoother(tt.alpha, tt.hysteresis, func(context.Context) ([]interface{}, error) {
+				return tt.last, nil
+			})
+			for i, raw := range tt.raw {
+				smoothed := smoother.smooth(context.TODO(), raw)
+				if got := scoreValues(smoothed)["score0"]; got != tt.want[i] {
+					t.Errorf("cycle %d: score = %d, want %d", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScoreSmootherRestoreError(t *testing.T) {
+	calls := 0
+	smoother := newScoreSmoother(0.5, 0, func(context.Context) ([]interface{}, error) {
+		calls++
+		return nil, fmt.Errorf("hub unreachable")
+	})
+	score := func(value int64) []interface{} {
+		return []interface{}{map[string]interface{}{"name": "score0", "value": value}}
+	}
+
+	// A hub outage doesn't hold back the scores: smoothing starts from the current ones
+	if got := scoreValues(smoother.smooth(context.TODO(), score(80)))["score0"]; got != 80 {
+		t.Errorf("score = %d, want 80", got)
+	}
+	if got := scoreValues(smoother.smooth(context.TODO(), score(40)))["score0"]; got != 60 || calls != 1 {
+		t.Errorf("score = %d after %d restores, want 60 after 1", got, calls)
+	}
+}
+
+func TestLastPublishedScores(t *testing.T) {
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+
+	published := newPlacementScore("cluster1")
+	published.Object["status"] = map[string]interface{}{
+		"scores": []interface{}{map[string]interface{}{"name": "podCount", "value": int64(20)}},
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{scoreGVR: "AddOnPlacementScoreList"}, published)
+
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := opts.lastPublishedScores(context.TODO(), client, b)
+	if err != nil {
+		t.Fatalf("lastPublishedScores() error = %v", err)
+	}
+	if got := scoreValues(last)["podCount"]; got != 20 {
+		t.Errorf("podCount from hub = %d, want 20", got)
+	}
+
+	// A buffered write is newer than the score on the hub
+	b.register(strategyPlacementScore, func(context.Context, []byte) error { return fmt.Errorf("hub unreachable") })
+	_ = b.publish(context.TODO(), strategyPlacementScore, PlacementScoreName,
+		[]byte(`{"scores":[{"name":"podCount","value":-30}]}`))
+	last, err = opts.lastPublishedScores(context.TODO(), client, b)
+	if err != nil {
+		t.Fatalf("lastPublishedScores() error = %v", err)
+	}
+	if got := scoreValues(last)["podCount"]; got != -30 {
+		t.Errorf("podCount from outbox = %d, want -30", got)
+	}
+
+	empty := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{scoreGVR: "AddOnPlacementScoreList"})
+	emptyOutbox, _ := newOutbox("", DefaultOutboxMaxEntries)
+	if last, err := opts.lastPublishedScores(context.TODO(), empty, emptyOutbox); err != nil || last != nil {
+		t.Errorf("lastPublishedScores() = %v, %v, want nothing when no score was published", last, err)
+	}
+}
@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Metrics a placement score can be computed from.
+const (
+	MetricNamespaceCount  = "namespaceCount"
+	MetricPodCount        = "podCount"
+	MetricFreeCPUMillis   = "freeCPUMillis"
+	MetricFreeMemoryBytes = "freeMemoryBytes"
+	MetricFreePodSlots    = "freePodSlots"
+	MetricHeadroomRatio   = "headroomRatio"
+	// MetricFreeStorageBytes is the space left in the PVCs mounted by running
+	// pods, from the kubelet volume stats. Not used by the default scorers.
+	MetricFreeStorageBytes = "freeStorageBytes"
+)
+
+// Normalizations map a metric value to a score.
+const (
+	// NormalizationLinear maps [min, max] linearly.
+	NormalizationLinear = "linear"
+	// NormalizationLog maps [min, max] logarithmically, so differences near min weigh more.
+	NormalizationLog = "log"
+	// NormalizationSigmoid maps [min, max] to an S curve centered between them.
+	NormalizationSigmoid = "sigmoid"
+	// NormalizationFixedPercentile ranks the value against the fixed
+	// distribution given in the scorer configuration, e.g. the metric measured
+	// once across a sample of the fleet. It is not the live fleet percentile.
+	NormalizationFixedPercentile = "fixedPercentile"
+)
+
+// Score directions.
+const (
+	DirectionHigherIsBetter = "higherIsBetter"
+	DirectionLowerIsBetter  = "lowerIsBetter"
+)
+
+const (
+	minScore = -100
+	maxScore = 100
+)
+
+// ScorerConfig describes how a placement score is computed from a metric.
+type ScorerConfig struct {
+	// Name is the score name used by Placements in scoreCoordinate.addOn.scoreName.
+	Name string `json:"name"`
+	// Metric is the source metric, one of the Metric* constants.
+	Metric string `json:"metric"`
+	// Normalization is one of the Normalization* constants. Defaults to linear.
+	Normalization string `json:"normalization,omitempty"`
+	// Min and Max bound the metric values that get different scores. Values
+	// outside them get the lowest or highest score. Not used by fixedPercentile.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+	// Direction is one of the Direction* constants. Defaults to higherIsBetter.
+	Direction string `json:"direction,omitempty"`
+	// FixedDistribution are the values the metric is ranked against, used by
+	// fixedPercentile. They are static: neither the agent nor the hub updates them.
+	FixedDistribution []float64 `json:"fixedDistribution,omitempty"`
+}
+
+// DefaultScorers returns the scorers used when no configuration is given.
+func DefaultScorers() []ScorerConfig {
+	return []ScorerConfig{
+		{Name: "namespaceCount", Metric: MetricNamespaceCount, Normalization: NormalizationLinear, Max: 50, Direction: DirectionLowerIsBetter},
+		{Name: "podCount", Metric: MetricPodCount, Normalization: NormalizationLinear, Max: 200, Direction: DirectionLowerIsBetter},
+		{Name: "cpuAvailable", Metric: MetricFreeCPUMillis, Normalization: NormalizationLinear, Max: 64 * 1000, Direction: DirectionHigherIsBetter},
+		{Name: "memoryAvailable", Metric: MetricFreeMemoryBytes, Normalization: NormalizationLinear, Max: 256 << 30, Direction: DirectionHigherIsBetter},
+		{Name: "podSlotsAvailable", Metric: MetricFreePodSlots, Normalization: NormalizationLinear, Max: 500, Direction: DirectionHigherIsBetter},
+		{Name: "allocatableHeadroom", Metric: MetricHeadroomRatio, Normalization: NormalizationLinear, Max: 1, Direction: DirectionHigherIsBetter},
+	}
+}
+
+// loadScorers reads the scorer configuration from file, a JSON list of
+// ScorerConfig. An empty file name returns the default scorers.
+func loadScorers(file string) ([]ScorerConfig, error) {
+	if len(file) == 0 {
+		return DefaultScorers(), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read placement scorers: %w", err)
+	}
+	scorers := []ScorerConfig{}
+	if err := json.Unmarshal(data, &scorers); err != nil {
+		return nil, fmt.Errorf("failed to decode placement scorers: %w", err)
+	}
+	// Scores are keyed by name in the AddOnPlacementScore, a duplicate would shadow the other
+	names := sets.New[string]()
+	for i := range scorers {
+		if err := scorers[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid placement scorer %q: %w", scorers[i].Name, err)
+		}
+		if names.Has(scorers[i].Name) {
+			return nil, fmt.Errorf("duplicate placement scorer %q", scorers[i].Name)
+		}
+		names.Insert(scorers[i].Name)
+	}
+	return scorers, nil
+}
+
+// validate checks the scorer and fills in defaults.
+func (s *ScorerConfig) validate() error {
+	if len(s.Name) == 0 {
+		return fmt.Errorf("name is required")
+	}
+	switch s.Metric {
+	case MetricNamespaceCount, MetricPodCount, MetricFreeCPUMillis, MetricFreeMemoryBytes, MetricFreePodSlots, MetricHeadroomRatio,
+		MetricFreeStorageBytes:
+	default:
+		return fmt.Errorf("unknown metric %q", s.Metric)
+	}
+	if len(s.Direction) == 0 {
+		s.Direction = DirectionHigherIsBetter
+	}
+	if s.Direction != DirectionHigherIsBetter && s.Direction != DirectionLowerIsBetter {
+		return fmt.Errorf("unknown direction %q", s.Direction)
+	}
+	if len(s.Normalization) == 0 {
+		s.Normalization = NormalizationLinear
+	}
+	switch s.Normalization {
+	case NormalizationLinear, NormalizationLog, NormalizationSigmoid:
+		if s.Max <= s.Min {
+			return fmt.Errorf("max (%v) must be greater than min (%v)", s.Max, s.Min)
+		}
+	case NormalizationFixedPercentile:
+		if len(s.FixedDistribution) == 0 {
+			return fmt.Errorf("fixedDistribution are required by fixedPercentile normalization")
+		}
+	default:
+		return fmt.Errorf("unknown normalization %q", s.Normalization)
+	}
+	return nil
+}
+
+// score converts a metric value to a score in [-100, 100] range.
+func (s ScorerConfig) score(value float64) int64 {
+	// fraction of the way from the worst to the best score
+	var fraction float64
+	switch s.Normalization {
+	case NormalizationLog:
+		fraction = math.Log1p(math.Max(value-s.Min, 0)) / math.Log1p(s.Max-s.Min)
+	case NormalizationSigmoid:
+		// Scaled so min and max land near the ends of the curve
+		midpoint := (s.Min + s.Max) / 2
+		fraction = 1 / (1 + math.Exp(-8*(value-midpoint)/(s.Max-s.Min)))
+	case NormalizationFixedPercentile:
+		fraction = percentileRank(value, s.FixedDistribution)
+	default:
+		fraction = (value - s.Min) / (s.Max - s.Min)
+	}
+	fraction = math.Min(math.Max(fraction, 0), 1)
+	if s.Direction == DirectionLowerIsBetter {
+		fraction = 1 - fraction
+	}
+	return clampScore(math.Round(minScore + fraction*(maxScore-minScore)))
+}
+
+// percentileRank returns the fraction of the distribution below value, counting equal values as half.
+func percentileRank(value float64, distribution []float64) float64 {
+	sorted := append([]float64(nil), distribution...)
+	sort.Float64s(sorted)
+	below := sort.SearchFloat64s(sorted, value)
+	equal := 0
+	for i := below; i < len(sorted) && sorted[i] == value; i++ {
+		equal++
+	}
+	return (float64(below) + float64(equal)/2) / float64(len(sorted))
+}
+
+// clampScore clamps a score to the [-100, 100] range OCM accepts.
+func clampScore(score float64) int64 {
+	if math.IsNaN(score) {
+		return 0
+	}
+	return int64(math.Min(math.Max(score, minScore), maxScore))
+}
+
+// computeScores returns the placement scores of the configured scorers.
+func computeScores(scorers []ScorerConfig, metrics map[string]float64) []interface{} {
+	scores := []interface{}{}
+	for _, scorer := range scorers {
+		scores = append(scores, map[string]interface{}{
+			"name":  scorer.Name,
+			"value": scorer.score(metrics[scorer.Metric]),
+		})
+	}
+	return scores
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScorerScore(t *testing.T) {
+	distribution := []float64{10, 20, 30, 40}
+
+	tests := []struct {
+		name   string
+		scorer ScorerConfig
+		value  float64
+		want   int64
+	}{
+		{name: "linear at min", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 100}, value: 0, want: -100},
+		{name: "linear midpoint", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 100}, value: 50, want: 0},
+		{name: "linear at max", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 100}, value: 100, want: 100},
+		{name: "linear clamped above max", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 100}, value: 1000, want: 100},
+		{name: "linear clamped below min", scorer: ScorerConfig{Normalization: NormalizationLinear, Min: 10, Max: 100}, value: -50, want: -100},
+		{name: "linear lower is better", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 50, Direction: DirectionLowerIsBetter}, value: 10, want: 60},
+		{name: "linear lower is better clamped", scorer: ScorerConfig{Normalization: NormalizationLinear, Max: 50, Direction: DirectionLowerIsBetter}, value: 500, want: -100},
+		{name: "log at min", scorer: ScorerConfig{Normalization: NormalizationLog, Max: 1000}, value: 0, want: -100},
+		{name: "log favors small values", scorer: ScorerConfig{Normalization: NormalizationLog, Max: 1000}, value: 31, want: 0},
+		{name: "log clamped above max", scorer: ScorerConfig{Normalization: NormalizationLog, Max: 1000}, value: 1e9, want: 100},
+		{name: "log clamped below min", scorer: ScorerConfig{Normalization: NormalizationLog, Min: 10, Max: 1000}, value: 0, want: -100},
+		{name: "sigmoid midpoint", scorer: ScorerConfig{Normalization: NormalizationSigmoid, Max: 100}, value: 50, want: 0},
+		{name: "sigmoid near max", scorer: ScorerConfig{Normalization: NormalizationSigmoid, Max: 100}, value: 100, want: 96},
+		{name: "sigmoid far above max", scorer: ScorerConfig{Normalization: NormalizationSigmoid, Max: 100}, value: 1e6, want: 100},
+		{name: "sigmoid far below min", scorer: ScorerConfig{Normalization: NormalizationSigmoid, Max: 100}, value: -1e6, want: -100},
+		{name: "percentile below distribution", scorer: ScorerConfig{Normalization: NormalizationFixedPercentile, FixedDistribution: distribution}, value: 0, want: -100},
+		{name: "percentile median", scorer: ScorerConfig{Normalization: NormalizationFixedPercentile, FixedDistribution: distribution}, value: 25, want: 0},
+		{name: "percentile equal value", scorer: ScorerConfig{Normalization: NormalizationFixedPercentile, FixedDistribution: distribution}, value: 40, want: 75},
+		{name: "percentile above distribution", scorer: ScorerConfig{Normalization: NormalizationFixedPercentile, FixedDistribution: distribution}, value: 100, want: 100},
+		{name: "percentile lower is better", scorer: ScorerConfig{Normalization: NormalizationFixedPercentile, FixedDistribution: distribution, Direction: DirectionLowerIsBetter}, value: 100, want: -100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scorer.score(tt.value); got != tt.want {
+				t.Errorf("score(%v) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadScorers(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantErr     bool
+		wantScorers []ScorerConfig
+	}{
+		{
+			name:        "defaults are filled in",
+			content:     `[{"name":"cpu","metric":"freeCPUMillis","max":64000}]`,
+			wantScorers: []ScorerConfig{{Name: "cpu", Metric: MetricFreeCPUMillis, Normalization: NormalizationLinear, Max: 64000, Direction: DirectionHigherIsBetter}},
+		},
+		{
+			name:    "free storage",
+			content: `[{"name":"storage","metric":"freeStorageBytes","normalization":"log","max":1099511627776}]`,
+			wantScorers: []ScorerConfig{{Name: "storage", Metric: MetricFreeStorageBytes, Normalization: NormalizationLog,
+				Max: 1 << 40, Direction: DirectionHigherIsBetter}},
+		},
+		{name: "invalid json", content: `{`, wantErr: true},
+		{name: "unknown metric", content: `[{"name":"x","metric":"gpus","max":1}]`, wantErr: true},
+		{name: "unknown normalization", content: `[{"name":"x","metric":"podCount","normalization":"cubic","max":1}]`, wantErr: true},
+		{name: "unknown direction", content: `[{"name":"x","metric":"podCount","direction":"up","max":1}]`, wantErr: true},
+		{name: "empty bounds", content: `[{"name":"x","metric":"podCount"}]`, wantErr: true},
+		{name: "duplicate name", content: `[{"name":"x","metric":"podCount","max":1},{"name":"x","metric":"freePodSlots","max":1}]`, wantErr: true},
+		{name: "percentile without distribution", content: `[{"name":"x","metric":"podCount","normalization":"fixedPercentile"}]`, wantErr: true},
+		{name: "missing name", content: `[{"metric":"podCount","max":1}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "scorers.json")
+			if err := os.WriteFile(file, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			scorers, err := loadScorers(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadScorers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(scorers, tt.wantScorers) {
+				t.Errorf("loadScorers() = %+v, want %+v", scorers, tt.wantScorers)
+			}
+		})
+	}
+
+	scorers, err := loadScorers("")
+	if err != nil || !reflect.DeepEqual(scorers, DefaultScorers()) {
+		t.Errorf("loadScorers(\"\") = %v, %v, want the default scorers", scorers, err)
+	}
+	for _, scorer := range DefaultScorers() {
+		if err := scorer.validate(); err != nil {
+			t.Errorf("default scorer %s is invalid: %v", scorer.Name, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// StorageReportConfigMapName is the ConfigMap with the PVCs and StorageClasses of the spoke.
+	StorageReportConfigMapName = "storage-report"
+
+	// maxStorageReportEntries keeps the report below the ConfigMap size limit.
+	// Flagged PVCs are kept first.
+	maxStorageReportEntries = 2000
+
+	// defaultStorageClassAnnotation marks the default StorageClass of the cluster.
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+	// kubeletStatsTimeout bounds each stats summary request, so an unreachable
+	// kubelet doesn't stall the strategy.
+	kubeletStatsTimeout = 10 * time.Second
+	// kubeletStatsWorkers is how many kubelets are queried at the same time.
+	kubeletStatsWorkers = 5
+)
+
+// StorageReport is the structure sent to the hub with the storage of the spoke.
+type StorageReport struct {
+	ClusterName string    `json:"clusterName"`
+	Timestamp   time.Time `json:"timestamp"`
+	TotalPVCs   int       `json:"totalPVCs"`
+	// FlaggedPVCs counts the Pending and Lost PVCs.
+	FlaggedPVCs int `json:"flaggedPVCs"`
+	// FreeBytes is the space left in the PVCs with volume stats, and
+	// VolumeStatsNodes the nodes the stats were read from.
+	FreeBytes        *int64             `json:"freeBytes,omitempty"`
+	VolumeStatsNodes int                `json:"volumeStatsNodes"`
+	StorageClasses   []StorageClassInfo `json:"storageClasses"`
+	// Truncated is set when PVCs were left out of the report.
+	Truncated bool      `json:"truncated,omitempty"`
+	PVCs      []PVCInfo `json:"pvcs"`
+}
+
+// StorageClassInfo describes a StorageClass of the spoke.
+type StorageClassInfo struct {
+	Name              string `json:"name"`
+	Provisioner       string `json:"provisioner"`
+	Default           bool   `json:"default,omitempty"`
+	ReclaimPolicy     string `json:"reclaimPolicy,omitempty"`
+	VolumeBindingMode string `json:"volumeBindingMode,omitempty"`
+	AllowExpansion    bool   `json:"allowVolumeExpansion,omitempty"`
+}
+
+// PVCInfo describes a PersistentVolumeClaim and, when a pod mounting it runs on
+// a node with kubelet stats, how much of its volume is used.
+type PVCInfo struct {
+	Namespace    string   `json:"namespace"`
+	Name         string   `json:"name"`
+	Phase        string   `json:"phase"`
+	StorageClass string   `json:"storageClass,omitempty"`
+	Requested    string   `json:"requested,omitempty"`
+	Capacity     string   `json:"capacity,omitempty"`
+	VolumeName   string   `json:"volumeName,omitempty"`
+	AccessModes  []string `json:"accessModes,omitempty"`
+	// Flagged is set for Pending and Lost PVCs.
+	Flagged        bool   `json:"flagged,omitempty"`
+	UsedBytes      *int64 `json:"usedBytes,omitempty"`
+	CapacityBytes  *int64 `json:"capacityBytes,omitempty"`
+	AvailableBytes *int64 `json:"availableBytes,omitempty"`
+}
+
+// syncStorageReport collects the PVCs and StorageClasses of the spoke, with the
+// volume stats of the kubelets, and sends the storage report to the hub.
+func (o *AgentOptions) syncStorageReport(ctx context.Context, spokeClient kubernetes.Interface,
+	volumeStats volumeStatsFunc, outbox *outbox) error {
+	klog.V(4).Info("Syncing storage report")
+
+	pvcs, err := spokeClient.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	storageClasses, err := spokeClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	pods, err := spokeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	stats, nodes := collectVolumeStats(ctx, pods.Items, volumeStats)
+	report := buildStorageReport(o.SpokeClusterName, pvcs.Items, storageClasses.Items, stats)
+	report.VolumeStatsNodes = nodes
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyStorageReport, StorageReportConfigMapName, reportJSON)
+}
+
+// publishStorageReport creates or updates the storage report ConfigMap in hub.
+func (o *AgentOptions) publishStorageReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, StorageReportConfigMapName, reportJSON)
+}
+
+// buildStorageReport creates a StorageReport from the PVCs and StorageClasses,
+// with the volume stats of the PVCs found on the kubelets.
+func buildStorageReport(clusterName string, pvcs []corev1.PersistentVolumeClaim, storageClasses []storagev1.StorageClass,
+	stats map[types.NamespacedName]volumeUsage) StorageReport {
+	report := StorageReport{
+		ClusterName:    clusterName,
+		Timestamp:      time.Now().UTC(),
+		TotalPVCs:      len(pvcs),
+		StorageClasses: make([]StorageClassInfo, 0, len(storageClasses)),
+		PVCs:           make([]PVCInfo, 0, len(pvcs)),
+	}
+
+	for _, storageClass := range storageClasses {
+		info := StorageClassInfo{
+			Name:           storageClass.Name,
+			Provisioner:    storageClass.Provisioner,
+			Default:        storageClass.Annotations[defaultStorageClassAnnotation] == "true",
+			AllowExpansion: storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion,
+		}
+		if storageClass.ReclaimPolicy != nil {
+			info.ReclaimPolicy = string(*storageClass.ReclaimPolicy)
+		}
+		if storageClass.VolumeBindingMode != nil {
+			info.VolumeBindingMode = string(*storageClass.VolumeBindingMode)
+		}
+		report.StorageClasses = append(report.StorageClasses, info)
+	}
+	sort.Slice(report.StorageClasses, func(i, j int) bool {
+		return report.StorageClasses[i].Name < report.StorageClasses[j].Name
+	})
+
+	var freeBytes int64
+	for _, pvc := range pvcs {
+		info := PVCInfo{
+			Namespace:  pvc.Namespace,
+			Name:       pvc.Name,
+			Phase:      string(pvc.Status.Phase),
+			VolumeName: pvc.Spec.VolumeName,
+			Flagged:    pvc.Status.Phase == corev1.ClaimPending || pvc.Status.Phase == corev1.ClaimLost,
+		}
+		if pvc.Spec.StorageClassName != nil {
+			info.StorageClass = *pvc.Spec.StorageClassName
+		}
+		if requested, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			info.Requested = requested.String()
+		}
+		if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			info.Capacity = capacity.String()
+		}
+		for _, mode := range pvc.Spec.AccessModes {
+			info.AccessModes = append(info.AccessModes, string(mode))
+		}
+		if stat, ok := stats[types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}]; ok {
+			info.UsedBytes = stat.UsedBytes
+			info.CapacityBytes = stat.CapacityBytes
+			info.AvailableBytes = stat.AvailableBytes
+			if stat.AvailableBytes != nil {
+				freeBytes += *stat.AvailableBytes
+				report.FreeBytes = &freeBytes
+			}
+		}
+		if info.Flagged {
+			report.FlaggedPVCs++
+		}
+		report.PVCs = append(report.PVCs, info)
+	}
+
+	// Flagged first, so they are kept when the report is truncated
+	sort.Slice(report.PVCs, func(i, j int) bool {
+		a, b := report.PVCs[i], report.PVCs[j]
+		if a.Flagged != b.Flagged {
+			return a.Flagged
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	if len(report.PVCs) > maxStorageReportEntries {
+		report.PVCs = report.PVCs[:maxStorageReportEntries]
+		report.Truncated = true
+	}
+	return report
+}
+
+// volumeUsage is the usage of a volume, as reported by the kubelet stats summary.
+type volumeUsage struct {
+	UsedBytes      *int64        `json:"usedBytes,omitempty"`
+	CapacityBytes  *int64        `json:"capacityBytes,omitempty"`
+	AvailableBytes *int64        `json:"availableBytes,omitempty"`
+	PVCRef         *pvcReference `json:"pvcRef,omitempty"`
+}
+
+// pvcReference is the PVC a volume in the kubelet stats summary belongs to.
+type pvcReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// statsSummary is the part of the kubelet /stats/summary response with the volumes of the pods.
+type statsSummary struct {
+	Pods []struct {
+		Volumes []volumeUsage `json:"volume,omitempty"`
+	} `json:"pods"`
+}
+
+// volumeStatsFunc returns the stats of the volumes of the pods running on a node.
+type volumeStatsFunc func(ctx context.Context, nodeName string) ([]volumeUsage, error)
+
+// kubeletVolumeStats reads the volume stats from the stats summary of the
+// kubelets, through the node proxy of the API server, within the timeout.
+func kubeletVolumeStats(spokeClient kubernetes.Interface, timeout time.Duration) volumeStatsFunc {
+	return func(ctx context.Context, nodeName string) ([]volumeUsage, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		data, err := spokeClient.CoreV1().RESTClient().Get().
+			AbsPath("/api/v1/nodes", nodeName, "proxy", "stats", "summary").
+			DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		summary := statsSummary{}
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return nil, fmt.Errorf("failed to decode stats summary: %w", err)
+		}
+		var stats []volumeUsage
+		for _, pod := range summary.Pods {
+			stats = append(stats, pod.Volumes...)
+		}
+		return stats, nil
+	}
+}
+
+// volumeStatsCache shares the volume stats of each node between the strategies
+// that read them, so the kubelets are queried at most once per ttl. Failures
+// are cached too, so an unreachable kubelet isn't retried by every strategy.
+type volumeStatsCache struct {
+	volumeStats volumeStatsFunc
+	ttl         time.Duration
+	now         func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]volumeStatsEntry
+}
+
+type volumeStatsEntry struct {
+	stats     []volumeUsage
+	err       error
+	fetchedAt time.Time
+}
+
+func newVolumeStatsCache(volumeStats volumeStatsFunc, ttl time.Duration) *volumeStatsCache {
+	return &volumeStatsCache{
+		volumeStats: volumeStats,
+		ttl:         ttl,
+		now:         time.Now,
+		entries:     map[string]volumeStatsEntry{},
+	}
+}
+
+// get returns the volume stats of the node, read again once they are older than the ttl.
+func (c *volumeStatsCache) get(ctx context.Context, nodeName string) ([]volumeUsage, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[nodeName]
+	c.lock.Unlock()
+	if ok && c.now().Sub(entry.fetchedAt) < c.ttl {
+		return entry.stats, entry.err
+	}
+
+	stats, err := c.volumeStats(ctx, nodeName)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[nodeName] = volumeStatsEntry{stats: stats, err: err, fetchedAt: c.now()}
+	return stats, err
+}
+
+// collectVolumeStats returns the stats of the PVCs mounted by running pods,
+// from the nodes running them, and the number of nodes that returned stats.
+// Stats are best effort: nodes whose kubelet can't be reached are skipped. The
+// nodes are queried kubeletStatsWorkers at a time.
+func collectVolumeStats(ctx context.Context, pods []corev1.Pod,
+	volumeStats volumeStatsFunc) (map[types.NamespacedName]volumeUsage, int) {
+	nodes := sets.New[string]()
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || len(pod.Spec.NodeName) == 0 {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				nodes.Insert(pod.Spec.NodeName)
+				break
+			}
+		}
+	}
+
+	nodeNames := sets.List(nodes)
+	nodeStats := make([][]volumeUsage, len(nodeNames))
+	nodeErrs := make([]error, len(nodeNames))
+	workqueue.ParallelizeUntil(ctx, kubeletStatsWorkers, len(nodeNames), func(i int) {
+		nodeStats[i], nodeErrs[i] = volumeStats(ctx, nodeNames[i])
+	})
+
+	stats := map[types.NamespacedName]volumeUsage{}
+	available := 0
+	for i, node := range nodeNames {
+		if nodeErrs[i] != nil {
+			klog.V(2).Infof("Volume stats of node %s are not available: %v", node, nodeErrs[i])
+			continue
+		}
+		available++
+		for _, stat := range nodeStats[i] {
+			if stat.PVCRef != nil {
+				stats[types.NamespacedName{Namespace: stat.PVCRef.Namespace, Name: stat.PVCRef.Name}] = stat
+			}
+		}
+	}
+	return stats, available
+}
+
+// freeStorageBytes returns the space left in the PVCs mounted by running pods.
+func freeStorageBytes(ctx context.Context, pods []corev1.Pod, volumeStats volumeStatsFunc) int64 {
+	stats, _ := collectVolumeStats(ctx, pods, volumeStats)
+	var free int64
+	for _, stat := range stats {
+		if stat.AvailableBytes != nil {
+			free += *stat.AvailableBytes
+		}
+	}
+	return free
+}
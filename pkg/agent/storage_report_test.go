@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestBuildStorageReport(t *testing.T) {
+	className := "fast"
+	allowExpansion := true
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	storageClasses := []storagev1.StorageClass{
+		{
+			ObjectMeta:           metav1.ObjectMeta{Name: "fast", Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}},
+			Provisioner:          "ebs.csi.aws.com",
+			ReclaimPolicy:        &reclaimPolicy,
+			AllowVolumeExpansion: &allowExpansion,
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "archive"}, Provisioner: "nfs.csi.k8s.io"},
+	}
+	pvc := func(namespace, name string, phase corev1.PersistentVolumeClaimPhase) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &className,
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{Phase: phase},
+		}
+	}
+	bound := pvc("data", "db", corev1.ClaimBound)
+	bound.Spec.VolumeName = "pv-1"
+	bound.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	used, capacity, available := int64(4<<30), int64(10<<30), int64(6<<30)
+	stats := map[types.NamespacedName]volumeUsage{
+		{Namespace: "data", Name: "db"}: {UsedBytes: &used, CapacityBytes: &capacity, AvailableBytes: &available},
+	}
+
+	report := buildStorageReport("cluster1", []corev1.PersistentVolumeClaim{
+		bound, pvc("default", "cache", corev1.ClaimPending), pvc("default", "old", corev1.ClaimLost),
+	}, storageClasses, stats)
+
+	if report.TotalPVCs != 3 || report.FlaggedPVCs != 2 {
+		t.Errorf("TotalPVCs = %d, FlaggedPVCs = %d, want 3 and 2", report.TotalPVCs, report.FlaggedPVCs)
+	}
+	wantClasses := []StorageClassInfo{
+		{Name: "archive", Provisioner: "nfs.csi.k8s.io"},
+		{Name: "fast", Provisioner: "ebs.csi.aws.com", Default: true, ReclaimPolicy: "Delete", AllowExpansion: true},
+	}
+	if !reflect.DeepEqual(report.StorageClasses, wantClasses) {
+		t.Errorf("StorageClasses = %+v, want %+v", report.StorageClasses, wantClasses)
+	}
+
+	// Flagged PVCs first
+	var names []string
+	for _, info := range report.PVCs {
+		names = append(names, info.Namespace+"/"+info.Name)
+	}
+	if want := []string{"default/cache", "default/old", "data/db"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("PVCs = %v, want %v", names, want)
+	}
+	db := report.PVCs[2]
+	if db.Flagged || db.StorageClass != "fast" || db.Requested != "10Gi" || db.Capacity != "10Gi" || db.VolumeName != "pv-1" ||
+		!reflect.DeepEqual(db.AccessModes, []string{"ReadWriteOnce"}) || db.UsedBytes == nil || *db.UsedBytes != used {
+		t.Errorf("unexpected PVC %+v", db)
+	}
+	if report.PVCs[0].UsedBytes != nil {
+		t.Errorf("PVC without stats has used bytes %d", *report.PVCs[0].UsedBytes)
+	}
+	if report.FreeBytes == nil || *report.FreeBytes != available {
+		t.Errorf("FreeBytes = %v, want %d", report.FreeBytes, available)
+	}
+}
+
+func TestSyncStorageReport(t *testing.T) {
+	mounting := func(name, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "data"},
+			Spec: corev1.PodSpec{
+				NodeName: node,
+				Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+				}}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	spokeClient := kubefake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "queue", Namespace: "data"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		},
+		mounting("db", "node1"), mounting("queue", "node2"),
+	)
+	available := int64(1 << 30)
+	volumeStats := func(ctx context.Context, nodeName string) ([]volumeUsage, error) {
+		if nodeName == "node2" {
+			return nil, fmt.Errorf("kubelet unreachable")
+		}
+		return []volumeUsage{{AvailableBytes: &available, PVCRef: &pvcReference{Name: "db", Namespace: "data"}}}, nil
+	}
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyStorageReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishStorageReport(ctx, hubClient, payload)
+	})
+
+	if err := opts.syncStorageReport(context.TODO(), spokeClient, volumeStats, b); err != nil {
+		t.Fatalf("syncStorageReport() error = %v", err)
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), StorageReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("storage report was not published: %v", err)
+	}
+	report := StorageReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalPVCs != 2 || report.VolumeStatsNodes != 1 || report.FreeBytes == nil || *report.FreeBytes != available {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if free := freeStorageBytes(context.TODO(), []corev1.Pod{*mounting("db", "node1")}, volumeStats); free != available {
+		t.Errorf("freeStorageBytes() = %d, want %d", free, available)
+	}
+}
+
+func TestKubeletVolumeStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/nodes/slow/proxy/stats/summary" {
+			<-r.Context().Done()
+			return
+		}
+		if r.URL.Path != "/api/v1/nodes/node1/proxy/stats/summary" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"node": {"nodeName": "node1"}, "pods": [{"volume": [
+			{"name": "data", "usedBytes": 100, "capacityBytes": 1000, "availableBytes": 900, "pvcRef": {"name": "db", "namespace": "data"}},
+			{"name": "kube-api-access", "usedBytes": 10}]}]}`)
+	}))
+	defer server.Close()
+	spokeClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumeStats := kubeletVolumeStats(spokeClient, 100*time.Millisecond)
+	stats, err := volumeStats(context.TODO(), "node1")
+	if err != nil {
+		t.Fatalf("kubeletVolumeStats() error = %v", err)
+	}
+	if len(stats) != 2 || stats[0].PVCRef == nil || stats[0].PVCRef.Name != "db" || *stats[0].AvailableBytes != 900 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err := volumeStats(context.TODO(), "node2"); err == nil {
+		t.Error("expected error for a node without stats")
+	}
+	if _, err := volumeStats(context.TODO(), "slow"); err == nil {
+		t.Error("expected error for a kubelet that doesn't answer within the timeout")
+	}
+}
+
+func TestVolumeStatsCache(t *testing.T) {
+	calls := map[string]int{}
+	cache := newVolumeStatsCache(func(ctx context.Context, nodeName string) ([]volumeUsage, error) {
+		calls[nodeName]++
+		if nodeName == "node2" {
+			return nil, fmt.Errorf("kubelet unreachable")
+		}
+		return []volumeUsage{{PVCRef: &pvcReference{Name: "db", Namespace: "data"}}}, nil
+	}, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if stats, err := cache.get(context.TODO(), "node1"); err != nil || len(stats) != 1 {
+			t.Fatalf("get(node1) = %v, %v", stats, err)
+		}
+		if _, err := cache.get(context.TODO(), "node2"); err == nil {
+			t.Fatal("expected the cached error of node2")
+		}
+	}
+	if calls["node1"] != 1 || calls["node2"] != 1 {
+		t.Errorf("calls = %v, want one per node within the ttl", calls)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := cache.get(context.TODO(), "node1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls["node1"] != 2 {
+		t.Errorf("node1 calls = %d, want the stats read again once expired", calls["node1"])
+	}
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultStrategyFailureThreshold is the number of consecutive failures after
+	// which a strategy's circuit opens.
+	DefaultStrategyFailureThreshold = 5
+	// DefaultStrategyOpenRetryInterval is how often a strategy with an open circuit is retried.
+	DefaultStrategyOpenRetryInterval = 10 * time.Minute
+
+	// StrategiesHealthyConditionType is the addon condition listing degraded strategies.
+	StrategiesHealthyConditionType = "SyncStrategiesHealthy"
+)
+
+// strategyState tracks the failures of a single strategy.
+type strategyState struct {
+	consecutiveFailures int
+	nextAttempt         time.Time
+	lastError           string
+}
+
+// strategyBreaker backs off strategies that keep failing, so a strategy that
+// can't work on this hub (e.g. a missing CRD) doesn't retry every cycle and
+// fill the logs. Each failure doubles the delay before the next attempt,
+// starting at the strategy's baseDelay. After failureThreshold consecutive failures the
+// circuit opens and the strategy is only retried every openRetryInterval,
+// until it succeeds again.
+type strategyBreaker struct {
+	failureThreshold  int
+	baseDelay         func(strategy string) time.Duration
+	openRetryInterval time.Duration
+	now               func() time.Time
+
+	lock   sync.Mutex
+	states map[string]*strategyState
+}
+
+func newStrategyBreaker(failureThreshold int, baseDelay func(strategy string) time.Duration, openRetryInterval time.Duration) *strategyBreaker {
+	return &strategyBreaker{
+		failureThreshold:  failureThreshold,
+		baseDelay:         baseDelay,
+		openRetryInterval: openRetryInterval,
+		now:               time.Now,
+		states:            map[string]*strategyState{},
+	}
+}
+
+// allow returns whether the strategy should run now.
+func (b *strategyBreaker) allow(strategy string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.states[strategy]
+	return !ok || !b.now().Before(state.nextAttempt)
+}
+
+// record stores the result of a strategy run and returns whether its circuit
+// opened or closed as a result.
+func (b *strategyBreaker) record(strategy string, err error) (opened, closed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state, ok := b.states[strategy]
+	if err == nil {
+		if ok {
+			delete(b.states, strategy)
+			return false, state.consecutiveFailures >= b.failureThreshold
+		}
+		return false, false
+	}
+
+	if !ok {
+		state = &strategyState{}
+		b.states[strategy] = state
+	}
+	state.consecutiveFailures++
+	state.lastError = err.Error()
+
+	if state.consecutiveFailures >= b.failureThreshold {
+		state.nextAttempt = b.now().Add(b.openRetryInterval)
+		return state.consecutiveFailures == b.failureThreshold, false
+	}
+
+	delay := b.baseDelay(strategy)
+	for i := 1; i < state.consecutiveFailures; i++ {
+		delay *= 2
+	}
+	if delay > b.openRetryInterval {
+		delay = b.openRetryInterval
+	}
+	state.nextAttempt = b.now().Add(delay)
+	return false, false
+}
+
+// isOpen returns whether the strategy's circuit is open.
+func (b *strategyBreaker) isOpen(strategy string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.states[strategy]
+	return ok && state.consecutiveFailures >= b.failureThreshold
+}
+
+// condition returns the addon condition summarizing the strategies with an open circuit.
+func (b *strategyBreaker) condition() map[string]interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var degraded []string
+	for strategy, state := range b.states {
+		if state.consecutiveFailures >= b.failureThreshold {
+			degraded = append(degraded, fmt.Sprintf("%s (%d consecutive failures: %s)",
+				strategy, state.consecutiveFailures, state.lastError))
+		}
+	}
+	sort.Strings(degraded)
+
+	status := metav1.ConditionTrue
+	reason := "AllStrategiesSyncing"
+	message := "All sync strategies are healthy"
+	if len(degraded) > 0 {
+		status = metav1.ConditionFalse
+		reason = "StrategiesDegraded"
+		message = fmt.Sprintf("Degraded sync strategies, retried every %s: %s",
+			b.openRetryInterval, strings.Join(degraded, "; "))
+	}
+
+	return map[string]interface{}{
+		"type":               StrategiesHealthyConditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": metav1.Now().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// conditionPayload returns the strategies condition serialized for the outbox.
+func (b *strategyBreaker) conditionPayload() ([]byte, error) {
+	return json.Marshal(b.condition())
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStrategyBreaker(t *testing.T) {
+	baseDelay := func(strategy string) time.Duration {
+		if strategy == strategyPlacementScore {
+			return time.Minute
+		}
+		return time.Hour
+	}
+	breaker := newStrategyBreaker(3, baseDelay, 10*time.Minute)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	failure := fmt.Errorf("the server could not find the requested resource")
+
+	// Failures below the threshold back off exponentially
+	for i, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if !breaker.allow(strategyPlacementScore) {
+			t.Fatalf("attempt %d: expected strategy to be allowed", i+1)
+		}
+		if opened, _ := breaker.record(strategyPlacementScore, failure); opened {
+			t.Fatalf("attempt %d: circuit opened before the threshold", i+1)
+		}
+		now = now.Add(wantDelay - time.Second)
+		if breaker.allow(strategyPlacementScore) {
+			t.Fatalf("attempt %d: expected strategy to back off for %s", i+1, wantDelay)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// Reaching the threshold opens the circuit and degrades the condition
+	if opened, _ := breaker.record(strategyPlacementScore, failure); !opened {
+		t.Fatal("expected circuit to open at the threshold")
+	}
+	condition := breaker.condition()
+	if condition["status"] != string(metav1.ConditionFalse) {
+		t.Errorf("condition status = %v, want False", condition["status"])
+	}
+	if message, _ := condition["message"].(string); !strings.Contains(message, strategyPlacementScore) || !strings.Contains(message, failure.Error()) {
+		t.Errorf("condition message %q doesn't name the strategy and error", message)
+	}
+
+	// Other strategies are not affected
+	if !breaker.allow(strategyPodReport) {
+		t.Error("expected other strategies to be allowed")
+	}
+
+	// Retried periodically, and closed on success
+	now = now.Add(10 * time.Minute)
+	if !breaker.allow(strategyPlacementScore) {
+		t.Fatal("expected open circuit to be retried after the retry interval")
+	}
+	if _, closed := breaker.record(strategyPlacementScore, nil); !closed {
+		t.Error("expected circuit to close on success")
+	}
+	if breaker.condition()["status"] != string(metav1.ConditionTrue) {
+		t.Errorf("condition status = %v, want True", breaker.condition()["status"])
+	}
+}
@@ -0,0 +1,336 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// WorkloadReportConfigMapName is the ConfigMap with the workloads of the spoke.
+	WorkloadReportConfigMapName = "workload-report"
+
+	// maxWorkloadReportEntries keeps the report below the ConfigMap size limit.
+	maxWorkloadReportEntries = 2000
+)
+
+// Rollout status of a workload.
+const (
+	RolloutComplete    = "Complete"
+	RolloutProgressing = "Progressing"
+	// RolloutStalled is a Deployment past its progress deadline.
+	RolloutStalled = "Stalled"
+	// RolloutRunning and RolloutFailed apply to Jobs.
+	RolloutRunning = "Running"
+	RolloutFailed  = "Failed"
+)
+
+// WorkloadReport is the structure sent to the hub with the workloads of the spoke.
+type WorkloadReport struct {
+	ClusterName    string    `json:"clusterName"`
+	Timestamp      time.Time `json:"timestamp"`
+	TotalWorkloads int       `json:"totalWorkloads"`
+	// Truncated is set when workloads were left out of the report.
+	Truncated bool           `json:"truncated,omitempty"`
+	Workloads []WorkloadInfo `json:"workloads"`
+}
+
+// WorkloadInfo contains the rollout state of a Deployment, StatefulSet,
+// DaemonSet or Job. For Jobs, desired is the number of completions, ready the
+// number of ready pods and updated the number of succeeded pods.
+type WorkloadInfo struct {
+	Kind          string   `json:"kind"`
+	Namespace     string   `json:"namespace"`
+	Name          string   `json:"name"`
+	Desired       int32    `json:"desired"`
+	Ready         int32    `json:"ready"`
+	Updated       int32    `json:"updated"`
+	Images        []string `json:"images"`
+	RolloutStatus string   `json:"rolloutStatus"`
+	// LastRolloutTime is when the current revision was rolled out, or when
+	// the Job started.
+	LastRolloutTime *time.Time `json:"lastRolloutTime,omitempty"`
+}
+
+// workloadListers reads the workloads of the spoke from shared informer caches,
+// so building the report doesn't list every workload from the API server.
+type workloadListers struct {
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	daemonSets   appslisters.DaemonSetLister
+	revisions    appslisters.ControllerRevisionLister
+	jobs         batchlisters.JobLister
+}
+
+// newWorkloadListers registers the workload informers in the factory. They
+// run once the factory is started, and are read once their caches are synced.
+func newWorkloadListers(factory informers.SharedInformerFactory) *workloadListers {
+	deployments := factory.Apps().V1().Deployments()
+	statefulSets := factory.Apps().V1().StatefulSets()
+	daemonSets := factory.Apps().V1().DaemonSets()
+	revisions := factory.Apps().V1().ControllerRevisions()
+	jobs := factory.Batch().V1().Jobs()
+
+	return &workloadListers{
+		deployments:  deployments.Lister(),
+		statefulSets: statefulSets.Lister(),
+		daemonSets:   daemonSets.Lister(),
+		revisions:    revisions.Lister(),
+		jobs:         jobs.Lister(),
+	}
+}
+
+// syncWorkloadReport sends the workload report to the hub.
+func (o *AgentOptions) syncWorkloadReport(ctx context.Context, listers *workloadListers, outbox *outbox) error {
+	klog.V(4).Info("Syncing workload report")
+
+	report, err := buildWorkloadReport(o.SpokeClusterName, listers)
+	if err != nil {
+		return err
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return outbox.publish(ctx, strategyWorkloadReport, WorkloadReportConfigMapName, reportJSON)
+}
+
+// publishWorkloadReport creates or updates the workload report ConfigMap in hub.
+func (o *AgentOptions) publishWorkloadReport(ctx context.Context, hubClient kubernetes.Interface, reportJSON []byte) error {
+	return o.applyReportConfigMap(ctx, hubClient, WorkloadReportConfigMapName, reportJSON)
+}
+
+// buildWorkloadReport creates a WorkloadReport from the cached workloads.
+func buildWorkloadReport(clusterName string, listers *workloadListers) (WorkloadReport, error) {
+	report := WorkloadReport{
+		ClusterName: clusterName,
+		Timestamp:   time.Now().UTC(),
+		Workloads:   []WorkloadInfo{},
+	}
+
+	deployments, err := listers.deployments.List(labels.Everything())
+	if err != nil {
+		return report, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deployment := range deployments {
+		report.Workloads = append(report.Workloads, deploymentInfo(deployment))
+	}
+
+	statefulSets, err := listers.statefulSets.List(labels.Everything())
+	if err != nil {
+		return report, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, statefulSet := range statefulSets {
+		info := statefulSetInfo(statefulSet)
+		// The update revision is the revision being rolled out
+		revision, err := listers.revisions.ControllerRevisions(statefulSet.Namespace).Get(statefulSet.Status.UpdateRevision)
+		if err == nil {
+			info.LastRolloutTime = timePtr(revision.CreationTimestamp.Time)
+		}
+		report.Workloads = append(report.Workloads, info)
+	}
+
+	daemonSets, err := listers.daemonSets.List(labels.Everything())
+	if err != nil {
+		return report, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	revisions, err := listers.revisions.List(labels.Everything())
+	if err != nil {
+		return report, fmt.Errorf("failed to list controller revisions: %w", err)
+	}
+	latestRevisions := latestRevisionsByOwner(revisions)
+	for _, daemonSet := range daemonSets {
+		info := daemonSetInfo(daemonSet)
+		if revision, ok := latestRevisions[daemonSet.UID]; ok {
+			info.LastRolloutTime = timePtr(revision.CreationTimestamp.Time)
+		}
+		report.Workloads = append(report.Workloads, info)
+	}
+
+	jobs, err := listers.jobs.List(labels.Everything())
+	if err != nil {
+		return report, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for _, job := range jobs {
+		report.Workloads = append(report.Workloads, jobInfo(job))
+	}
+
+	sort.Slice(report.Workloads, func(i, j int) bool {
+		a, b := report.Workloads[i], report.Workloads[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	report.TotalWorkloads = len(report.Workloads)
+	if len(report.Workloads) > maxWorkloadReportEntries {
+		report.Workloads = report.Workloads[:maxWorkloadReportEntries]
+		report.Truncated = true
+	}
+	return report, nil
+}
+
+func deploymentInfo(deployment *appsv1.Deployment) WorkloadInfo {
+	desired := replicasOrDefault(deployment.Spec.Replicas)
+	info := WorkloadInfo{
+		Kind:      "Deployment",
+		Namespace: deployment.Namespace,
+		Name:      deployment.Name,
+		Desired:   desired,
+		Ready:     deployment.Status.ReadyReplicas,
+		Updated:   deployment.Status.UpdatedReplicas,
+		Images:    templateImages(&deployment.Spec.Template.Spec),
+	}
+
+	info.RolloutStatus = RolloutComplete
+	if deployment.Generation > deployment.Status.ObservedGeneration ||
+		deployment.Status.UpdatedReplicas < desired ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		info.RolloutStatus = RolloutProgressing
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type != appsv1.DeploymentProgressing {
+			continue
+		}
+		// Progressing is updated on every step of a rollout
+		info.LastRolloutTime = timePtr(condition.LastUpdateTime.Time)
+		if condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			info.RolloutStatus = RolloutStalled
+		}
+	}
+	return info
+}
+
+func statefulSetInfo(statefulSet *appsv1.StatefulSet) WorkloadInfo {
+	desired := replicasOrDefault(statefulSet.Spec.Replicas)
+	info := WorkloadInfo{
+		Kind:          "StatefulSet",
+		Namespace:     statefulSet.Namespace,
+		Name:          statefulSet.Name,
+		Desired:       desired,
+		Ready:         statefulSet.Status.ReadyReplicas,
+		Updated:       statefulSet.Status.UpdatedReplicas,
+		Images:        templateImages(&statefulSet.Spec.Template.Spec),
+		RolloutStatus: RolloutComplete,
+	}
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration ||
+		statefulSet.Status.UpdatedReplicas < desired ||
+		statefulSet.Status.ReadyReplicas < desired ||
+		(len(statefulSet.Status.UpdateRevision) > 0 && statefulSet.Status.CurrentRevision != statefulSet.Status.UpdateRevision) {
+		info.RolloutStatus = RolloutProgressing
+	}
+	return info
+}
+
+func daemonSetInfo(daemonSet *appsv1.DaemonSet) WorkloadInfo {
+	desired := daemonSet.Status.DesiredNumberScheduled
+	info := WorkloadInfo{
+		Kind:          "DaemonSet",
+		Namespace:     daemonSet.Namespace,
+		Name:          daemonSet.Name,
+		Desired:       desired,
+		Ready:         daemonSet.Status.NumberReady,
+		Updated:       daemonSet.Status.UpdatedNumberScheduled,
+		Images:        templateImages(&daemonSet.Spec.Template.Spec),
+		RolloutStatus: RolloutComplete,
+	}
+	if daemonSet.Generation > daemonSet.Status.ObservedGeneration ||
+		daemonSet.Status.UpdatedNumberScheduled < desired ||
+		daemonSet.Status.NumberAvailable < desired {
+		info.RolloutStatus = RolloutProgressing
+	}
+	return info
+}
+
+func jobInfo(job *batchv1.Job) WorkloadInfo {
+	info := WorkloadInfo{
+		Kind:          "Job",
+		Namespace:     job.Namespace,
+		Name:          job.Name,
+		Desired:       replicasOrDefault(job.Spec.Completions),
+		Updated:       job.Status.Succeeded,
+		Images:        templateImages(&job.Spec.Template.Spec),
+		RolloutStatus: RolloutRunning,
+	}
+	if job.Status.Ready != nil {
+		info.Ready = *job.Status.Ready
+	}
+	if job.Status.StartTime != nil {
+		info.LastRolloutTime = timePtr(job.Status.StartTime.Time)
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			info.RolloutStatus = RolloutComplete
+		case batchv1.JobFailed:
+			info.RolloutStatus = RolloutFailed
+		}
+	}
+	return info
+}
+
+// latestRevisionsByOwner indexes the newest ControllerRevision of each
+// controller by its UID, so each DaemonSet finds its own in a single lookup.
+func latestRevisionsByOwner(revisions []*appsv1.ControllerRevision) map[types.UID]*appsv1.ControllerRevision {
+	latest := map[types.UID]*appsv1.ControllerRevision{}
+	for _, revision := range revisions {
+		owner := metav1.GetControllerOf(revision)
+		if owner == nil {
+			continue
+		}
+		if current, ok := latest[owner.UID]; !ok || revision.Revision > current.Revision {
+			latest[owner.UID] = revision
+		}
+	}
+	return latest
+}
+
+// templateImages returns the distinct images of the containers of a pod template.
+func templateImages(spec *corev1.PodSpec) []string {
+	images := sets.New[string]()
+	for _, container := range spec.InitContainers {
+		images.Insert(container.Image)
+	}
+	for _, container := range spec.Containers {
+		images.Insert(container.Image)
+	}
+	return sets.List(images)
+}
+
+// replicasOrDefault returns the replicas, which default to 1 when unset.
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncWorkloadReport(t *testing.T) {
+	replicas := int32(3)
+	rolloutTime := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	template := func(images ...string) corev1.PodTemplateSpec {
+		spec := corev1.PodTemplateSpec{}
+		for i, image := range images {
+			spec.Spec.Containers = append(spec.Spec.Containers, corev1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+		}
+		return spec
+	}
+	isController := true
+
+	spokeClient := kubefake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: template("nginx:1.27", "envoy:1.30", "nginx:1.27")},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue,
+					Reason: "NewReplicaSetAvailable", LastUpdateTime: rolloutTime,
+				}},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", Generation: 5},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: template("api:2")},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 5, Replicas: 4, UpdatedReplicas: 1, ReadyReplicas: 3,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse,
+					Reason: "ProgressDeadlineExceeded", LastUpdateTime: rolloutTime,
+				}},
+			},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, Template: template("postgres:16")},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 2, UpdatedReplicas: 1, CurrentRevision: "db-1", UpdateRevision: "db-2",
+			},
+		},
+		&appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-2", Namespace: "data", CreationTimestamp: rolloutTime},
+			Revision:   2,
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "kube-system", UID: "ds-uid"},
+			Spec:       appsv1.DaemonSetSpec{Template: template("agent:1")},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 2, UpdatedNumberScheduled: 2, NumberAvailable: 2},
+		},
+		&appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "agent-old", Namespace: "kube-system", CreationTimestamp: metav1.NewTime(rolloutTime.Add(-time.Hour)),
+				OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent", UID: "ds-uid", Controller: &isController}},
+			},
+			Revision: 1,
+		},
+		&appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "agent-new", Namespace: "kube-system", CreationTimestamp: rolloutTime,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent", UID: "ds-uid", Controller: &isController}},
+			},
+			Revision: 2,
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"},
+			Spec:       batchv1.JobSpec{Template: template("migrate:1")},
+			Status: batchv1.JobStatus{
+				StartTime: &rolloutTime, Succeeded: 0, Failed: 6,
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}},
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	factory := informers.NewSharedInformerFactory(spokeClient, 0)
+	workloads := newWorkloadListers(factory)
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	hubClient := kubefake.NewSimpleClientset()
+	opts := NewAgentOptions("basic-addon")
+	opts.SpokeClusterName = "cluster1"
+	b, err := newOutbox("", DefaultOutboxMaxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.register(strategyWorkloadReport, func(ctx context.Context, payload []byte) error {
+		return opts.publishWorkloadReport(ctx, hubClient, payload)
+	})
+	if err := opts.syncWorkloadReport(ctx, workloads, b); err != nil {
+		t.Fatalf("syncWorkloadReport() error = %v", err)
+	}
+
+	configMap, err := hubClient.CoreV1().ConfigMaps("cluster1").Get(context.TODO(), WorkloadReportConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("workload report was not published: %v", err)
+	}
+	report := WorkloadReport{}
+	if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledOut := rolloutTime.UTC()
+	want := []WorkloadInfo{
+		{Kind: "DaemonSet", Namespace: "kube-system", Name: "agent", Desired: 2, Ready: 2, Updated: 2,
+			Images: []string{"agent:1"}, RolloutStatus: RolloutComplete, LastRolloutTime: &rolledOut},
+		{Kind: "Deployment", Namespace: "default", Name: "api", Desired: 3, Ready: 3, Updated: 1,
+			Images: []string{"api:2"}, RolloutStatus: RolloutStalled, LastRolloutTime: &rolledOut},
+		{Kind: "Deployment", Namespace: "default", Name: "web", Desired: 3, Ready: 3, Updated: 3,
+			Images: []string{"envoy:1.30", "nginx:1.27"}, RolloutStatus: RolloutComplete, LastRolloutTime: &rolledOut},
+		{Kind: "Job", Namespace: "default", Name: "migrate", Desired: 1,
+			Images: []string{"migrate:1"}, RolloutStatus: RolloutFailed, LastRolloutTime: &rolledOut},
+		{Kind: "StatefulSet", Namespace: "data", Name: "db", Desired: 3, Ready: 2, Updated: 1,
+			Images: []string{"postgres:16"}, RolloutStatus: RolloutProgressing, LastRolloutTime: &rolledOut},
+	}
+	if report.TotalWorkloads != len(want) || !reflect.DeepEqual(report.Workloads, want) {
+		t.Errorf("workloads = %+v, want %+v", report.Workloads, want)
+	}
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+const (
+	// CommandResyncInterval is how often completed commands are deleted.
+	CommandResyncInterval = 10 * time.Minute
+	// DefaultCommandTTL is how long a completed command is kept on the hub.
+	DefaultCommandTTL = 24 * time.Hour
+)
+
+// CommandReaper periodically deletes the AddonCommands the agents completed
+// once their TTL expires, so they don't pile up in the cluster namespaces.
+type CommandReaper struct {
+	dynamicClient dynamic.Interface
+	ttl           time.Duration
+	interval      time.Duration
+	now           func() time.Time
+}
+
+// NewCommandReaper returns a reaper of completed commands in all cluster namespaces.
+func NewCommandReaper(dynamicClient dynamic.Interface, ttl, interval time.Duration) *CommandReaper {
+	return &CommandReaper{
+		dynamicClient: dynamicClient,
+		ttl:           ttl,
+		interval:      interval,
+		now:           time.Now,
+	}
+}
+
+// Run deletes expired commands every interval until the context is done.
+func (r *CommandReaper) Run(ctx context.Context) {
+	klog.Infof("Starting command reaper (ttl %s, interval %s)", r.ttl, r.interval)
+	wait.UntilWithContext(ctx, r.reap, r.interval)
+}
+
+// reap deletes the completed commands whose TTL has passed.
+func (r *CommandReaper) reap(ctx context.Context) {
+	commands, err := r.dynamicClient.Resource(basicagent.CommandGVR).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("Failed to list completed commands: %v", err)
+		return
+	}
+
+	for _, command := range commands.Items {
+		completionTime, found, _ := unstructured.NestedString(command.Object, "status", "completionTime")
+		if !found {
+			// Not completed yet
+			continue
+		}
+		completed, err := time.Parse(time.RFC3339, completionTime)
+		if err != nil {
+			klog.Warningf("Command %s/%s has no valid completion time, keeping it", command.GetNamespace(), command.GetName())
+			continue
+		}
+		if r.now().Before(completed.Add(r.commandTTL(&command))) {
+			continue
+		}
+		err = r.dynamicClient.Resource(basicagent.CommandGVR).Namespace(command.GetNamespace()).Delete(ctx, command.GetName(), metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorf("Failed to delete completed command %s/%s: %v", command.GetNamespace(), command.GetName(), err)
+			continue
+		}
+		klog.Infof("Deleted completed command %s/%s", command.GetNamespace(), command.GetName())
+	}
+}
+
+// commandTTL returns how long the command is kept after it completed. The log
+// bundle of a collect-logs command is owned by it and deleted with it, so the
+// command is kept at least as long as the ttl it asked for the bundle.
+func (r *CommandReaper) commandTTL(command *unstructured.Unstructured) time.Duration {
+	value, found, _ := unstructured.NestedString(command.Object, "spec", "parameters", "ttl")
+	if !found {
+		return r.ttl
+	}
+	bundleTTL, err := time.ParseDuration(value)
+	if err != nil {
+		return r.ttl
+	}
+	return max(r.ttl, bundleTTL)
+}
@@ -0,0 +1,65 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+func TestCommandReaperDeletesExpiredCommands(t *testing.T) {
+	now := time.Now()
+	command := func(namespace, name string, completed bool, completedAgo time.Duration, params map[string]interface{}) *unstructured.Unstructured {
+		status := map[string]interface{}{"phase": basicagent.CommandRunning}
+		if completed {
+			status = map[string]interface{}{
+				"phase":          basicagent.CommandSucceeded,
+				"completionTime": now.Add(-completedAgo).UTC().Format(time.RFC3339),
+			}
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "basic-addon.open-cluster-management.io/v1alpha1",
+			"kind":       "AddonCommand",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+			"spec":       map[string]interface{}{"action": basicagent.CommandPodLogs, "parameters": params},
+			"status":     status,
+		}}
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{basicagent.CommandGVR: "AddonCommandList"},
+		command("cluster1", "expired", true, 2*DefaultCommandTTL, nil),
+		command("cluster2", "expired", true, 2*DefaultCommandTTL, nil),
+		command("cluster1", "recent", true, time.Hour, nil),
+		command("cluster1", "bundle-kept", true, 2*DefaultCommandTTL, map[string]interface{}{"ttl": "168h"}),
+		command("cluster1", "running", false, 0, nil),
+	)
+	reaper := NewCommandReaper(dynamicClient, DefaultCommandTTL, CommandResyncInterval)
+	reaper.now = func() time.Time { return now }
+	reaper.reap(context.TODO())
+
+	tests := []struct {
+		namespace string
+		name      string
+		wantExist bool
+	}{
+		{namespace: "cluster1", name: "expired", wantExist: false},
+		{namespace: "cluster2", name: "expired", wantExist: false},
+		{namespace: "cluster1", name: "recent", wantExist: true},
+		{namespace: "cluster1", name: "bundle-kept", wantExist: true},
+		{namespace: "cluster1", name: "running", wantExist: true},
+	}
+	for _, tt := range tests {
+		_, err := dynamicClient.Resource(basicagent.CommandGVR).Namespace(tt.namespace).Get(context.TODO(), tt.name, metav1.GetOptions{})
+		if exists := err == nil; exists != tt.wantExist {
+			t.Errorf("command %s/%s exists = %v, want %v", tt.namespace, tt.name, exists, tt.wantExist)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package hub
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const (
+	// rejectedCSRTTL is how long a rejected CSR is remembered, so it gets a
+	// single event. CSRs that are never approved are garbage collected by the
+	// hub after a day.
+	rejectedCSRTTL = 24 * time.Hour
+	// maxRejectedCSRs bounds the rejected CSRs remembered at the same time.
+	maxRejectedCSRs = 1000
+)
+
+// CSRApprovalPolicy configures which agent CSRs are approved automatically.
+type CSRApprovalPolicy struct {
+	// RequiredClusterLabels must all be set with the same value on the
+	// ManagedCluster before its agent CSRs are approved.
+	RequiredClusterLabels map[string]string
+	// Recorder records rejected CSRs as events on the ManagedClusterAddOn,
+	// once per CSR. Rejections are only logged when it is nil.
+	Recorder record.EventRecorder
+}
+
+// CSRApprover returns a CSRApproveFunc that only approves agent CSRs from
+// accepted clusters whose subject, groups and requester match the identity
+// the addon registered for that cluster. The framework calls it on every
+// resync of a pending CSR, so a rejection is only reported the first time.
+func CSRApprover(policy CSRApprovalPolicy) agent.CSRApproveFunc {
+	rejected := utilcache.NewLRUExpireCache(maxRejectedCSRs)
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+		csr *certificatesv1.CertificateSigningRequest) bool {
+		if err := policy.check(cluster, addon, csr); err != nil {
+			if _, ok := rejected.Get(csr.Name); ok {
+				klog.V(4).Infof("CSR %s for addon %s/%s still not approved: %v", csr.Name, addon.Namespace, addon.Name, err)
+				return false
+			}
+			rejected.Add(csr.Name, struct{}{}, rejectedCSRTTL)
+			klog.Infof("CSR %s for addon %s/%s not approved: %v", csr.Name, addon.Namespace, addon.Name, err)
+			if policy.Recorder != nil {
+				policy.Recorder.Eventf(addon, corev1.EventTypeWarning, "AgentCSRRejected",
+					"CSR %s was not approved: %v", csr.Name, err)
+			}
+			return false
+		}
+
+		klog.Infof("CSR %s for addon %s/%s approved", csr.Name, addon.Namespace, addon.Name)
+		return true
+	}
+}
+
+// check returns the reason the CSR doesn't satisfy the policy, or nil.
+func (p CSRApprovalPolicy) check(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	csr *certificatesv1.CertificateSigningRequest) error {
+	if !cluster.Spec.HubAcceptsClient ||
+		!meta.IsStatusConditionTrue(cluster.Status.Conditions, clusterv1.ManagedClusterConditionHubAccepted) {
+		return fmt.Errorf("managed cluster %s is not accepted by the hub", cluster.Name)
+	}
+
+	for key, value := range p.RequiredClusterLabels {
+		if got, ok := cluster.Labels[key]; !ok || got != value {
+			return fmt.Errorf("managed cluster %s doesn't have the required label %s=%s", cluster.Name, key, value)
+		}
+	}
+
+	if csr.Spec.SignerName != certificatesv1.KubeAPIServerClientSignerName {
+		return fmt.Errorf("unexpected signer %s", csr.Spec.SignerName)
+	}
+
+	// The registration agent of the cluster is the only expected requester
+	requesterPrefix := fmt.Sprintf("system:open-cluster-management:%s:", cluster.Name)
+	if !strings.HasPrefix(csr.Spec.Username, requesterPrefix) {
+		return fmt.Errorf("unexpected requester %s", csr.Spec.Username)
+	}
+
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return fmt.Errorf("PEM block type is not CERTIFICATE REQUEST")
+	}
+	x509cr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+
+	expectedUser := agent.DefaultUser(cluster.Name, addon.Name, AgentName(cluster))
+	if x509cr.Subject.CommonName != expectedUser {
+		return fmt.Errorf("unexpected common name %s, want %s", x509cr.Subject.CommonName, expectedUser)
+	}
+
+	expectedGroups := sets.New[string](agent.DefaultGroups(cluster.Name, addon.Name)...)
+	if !sets.New[string](x509cr.Subject.Organization...).Equal(expectedGroups) {
+		return fmt.Errorf("unexpected organizations %v, want %v", x509cr.Subject.Organization, sets.List(expectedGroups))
+	}
+
+	return nil
+}
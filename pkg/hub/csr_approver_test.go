@@ -0,0 +1,146 @@
+package hub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func TestCSRApprover(t *testing.T) {
+	addon := newTestAddon()
+	agentUser := agent.DefaultUser("test-cluster", addon.Name, AgentName(newAcceptedCluster("test-cluster", nil)))
+
+	tests := []struct {
+		name           string
+		cluster        *clusterv1.ManagedCluster
+		requiredLabels map[string]string
+		csr            *certificatesv1.CertificateSigningRequest
+		wantApproved   bool
+	}{
+		{
+			name:         "valid csr from accepted cluster",
+			cluster:      newAcceptedCluster("test-cluster", nil),
+			csr:          newTestCSR(t, "test-cluster", agentUser, agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved: true,
+		},
+		{
+			name: "cluster not accepted",
+			cluster: &clusterv1.ManagedCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+			},
+			csr:          newTestCSR(t, "test-cluster", agentUser, agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved: false,
+		},
+		{
+			name:           "required label present",
+			cluster:        newAcceptedCluster("test-cluster", map[string]string{"env": "prod"}),
+			requiredLabels: map[string]string{"env": "prod"},
+			csr:            newTestCSR(t, "test-cluster", agentUser, agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved:   true,
+		},
+		{
+			name:           "required label missing",
+			cluster:        newAcceptedCluster("test-cluster", map[string]string{"env": "dev"}),
+			requiredLabels: map[string]string{"env": "prod"},
+			csr:            newTestCSR(t, "test-cluster", agentUser, agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved:   false,
+		},
+		{
+			name:         "wrong agent name",
+			cluster:      newAcceptedCluster("test-cluster", nil),
+			csr:          newTestCSR(t, "test-cluster", agent.DefaultUser("test-cluster", addon.Name, "other"), agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved: false,
+		},
+		{
+			name:         "extra group",
+			cluster:      newAcceptedCluster("test-cluster", nil),
+			csr:          newTestCSR(t, "test-cluster", agentUser, append(agent.DefaultGroups("test-cluster", addon.Name), "system:masters")),
+			wantApproved: false,
+		},
+		{
+			name:         "requester from another cluster",
+			cluster:      newAcceptedCluster("test-cluster", nil),
+			csr:          newTestCSR(t, "test-cluster-2", agentUser, agent.DefaultGroups("test-cluster", addon.Name)),
+			wantApproved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			approve := CSRApprover(CSRApprovalPolicy{
+				RequiredClusterLabels: tt.requiredLabels,
+				Recorder:              recorder,
+			})
+
+			// The framework calls the approver again on every resync of a pending CSR
+			for i := 0; i < 3; i++ {
+				if got := approve(tt.cluster, addon, tt.csr); got != tt.wantApproved {
+					t.Errorf("CSRApprover() = %v, want %v", got, tt.wantApproved)
+				}
+			}
+
+			wantEvents := 0
+			if !tt.wantApproved {
+				wantEvents = 1
+			}
+			if len(recorder.Events) != wantEvents {
+				t.Errorf("expected %d events, got %d", wantEvents, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func newAcceptedCluster(name string, labels map[string]string) *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: clusterv1.ManagedClusterSpec{
+			HubAcceptsClient: true,
+		},
+		Status: clusterv1.ManagedClusterStatus{
+			Conditions: []metav1.Condition{
+				{
+					Type:   clusterv1.ManagedClusterConditionHubAccepted,
+					Status: metav1.ConditionTrue,
+				},
+			},
+		},
+	}
+}
+
+func newTestCSR(t *testing.T, requesterCluster, commonName string, orgs []string) *certificatesv1.CertificateSigningRequest {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName, Organization: orgs},
+	}, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate request: %v", err)
+	}
+
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "addon-csr"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Username:   "system:open-cluster-management:" + requesterCluster + ":abcde",
+		},
+	}
+}
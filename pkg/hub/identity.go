@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/klog/v2"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	clusterclient "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// AgentIdentityAnnotation holds the rotation token mixed into the agent name of
+// a cluster. Changing it rotates the agent identity.
+const AgentIdentityAnnotation = "basic-addon.open-cluster-management.io/agent-identity"
+
+// AgentName returns the agent name used in the CSR common name for the cluster.
+// It is derived from the cluster name and its rotation token, so it stays the
+// same across controller restarts and only changes on a deliberate rotation.
+func AgentName(cluster *clusterv1.ManagedCluster) string {
+	seed := cluster.Name
+	if token := cluster.Annotations[AgentIdentityAnnotation]; token != "" {
+		seed = fmt.Sprintf("%s:%s", seed, token)
+	}
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// AgentSignerConfigurations returns the kube client registration config for the
+// addon agent, using the stable agent name of each cluster.
+func AgentSignerConfigurations(addonName string) func(cluster *clusterv1.ManagedCluster) []addonapiv1alpha1.RegistrationConfig {
+	return func(cluster *clusterv1.ManagedCluster) []addonapiv1alpha1.RegistrationConfig {
+		return agent.KubeClientSignerConfigurations(addonName, AgentName(cluster))(cluster)
+	}
+}
+
+// RotateAgentIdentity sets a new rotation token on the ManagedCluster and
+// annotates the ManagedClusterAddOn so the addon manager re-registers the agent
+// with the new identity. The agent RoleBinding follows the new identity when
+// the RBAC is applied again, so the certificates of the old one lose their
+// access to the hub. It returns the new agent name.
+func RotateAgentIdentity(ctx context.Context, clusterClient clusterclient.Interface, addonClient addonclient.Interface,
+	clusterName, addonName string) (string, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AgentIdentityAnnotation: utilrand.String(8),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	cluster, err := clusterClient.ClusterV1().ManagedClusters().Patch(ctx, clusterName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to rotate identity on managed cluster %s: %w", clusterName, err)
+	}
+
+	// The addon manager only reconciles registrations on addon changes
+	_, err = addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName).Patch(ctx, addonName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to annotate addon %s/%s: %w", clusterName, addonName, err)
+	}
+
+	agentName := AgentName(cluster)
+	klog.Infof("Rotated agent identity of cluster %s to %s", clusterName, agentName)
+	return agentName, nil
+}
@@ -0,0 +1,59 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonfake "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterfake "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func TestAgentName(t *testing.T) {
+	cluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}}
+
+	name := AgentName(cluster)
+	if name != AgentName(cluster.DeepCopy()) {
+		t.Errorf("AgentName() is not deterministic")
+	}
+	if name == AgentName(&clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster2"}}) {
+		t.Errorf("AgentName() is the same for different clusters")
+	}
+
+	rotated := cluster.DeepCopy()
+	rotated.Annotations = map[string]string{AgentIdentityAnnotation: "token"}
+	if name == AgentName(rotated) {
+		t.Errorf("AgentName() didn't change after rotation")
+	}
+}
+
+func TestRotateAgentIdentity(t *testing.T) {
+	cluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	clusterClient := clusterfake.NewSimpleClientset(cluster)
+	addonClient := addonfake.NewSimpleClientset(newTestAddon())
+
+	agentName, err := RotateAgentIdentity(context.TODO(), clusterClient, addonClient, "test-cluster", "basic-addon")
+	if err != nil {
+		t.Fatalf("RotateAgentIdentity() error = %v", err)
+	}
+	if agentName == AgentName(cluster) {
+		t.Errorf("agent name was not rotated")
+	}
+
+	got, err := clusterClient.ClusterV1().ManagedClusters().Get(context.TODO(), "test-cluster", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if AgentName(got) != agentName {
+		t.Errorf("AgentName() = %s, want %s", AgentName(got), agentName)
+	}
+
+	addon, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("test-cluster").Get(context.TODO(), "basic-addon", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get addon: %v", err)
+	}
+	if addon.Annotations[AgentIdentityAnnotation] != got.Annotations[AgentIdentityAnnotation] {
+		t.Errorf("addon annotation = %q, want %q", addon.Annotations[AgentIdentityAnnotation], got.Annotations[AgentIdentityAnnotation])
+	}
+}
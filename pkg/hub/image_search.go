@@ -0,0 +1,116 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+// ImageMatch is an image of a managed cluster matching an image search.
+type ImageMatch struct {
+	ClusterName string
+	basicagent.ImageInfo
+}
+
+// ImageSearch is the result of FindImage.
+type ImageSearch struct {
+	Matches []ImageMatch
+	// IncompleteClusters are the clusters whose image report was truncated:
+	// the image may run there without being in the report.
+	IncompleteClusters []string
+}
+
+// FindImage returns the images matching the query in the image reports of all
+// clusters where the addon is enabled. The query is either a digest
+// ("sha256:..." or "repo@sha256:...", matched by digest only) or an image
+// reference, matched with or without its tag and docker.io/library/ prefix.
+func FindImage(ctx context.Context, kubeClient kubernetes.Interface, addonClient addonclient.Interface,
+	addonName, query string) (*ImageSearch, error) {
+	if len(query) == 0 {
+		return nil, fmt.Errorf("the image to search for is required")
+	}
+
+	addons, err := addonClient.AddonV1alpha1().ManagedClusterAddOns(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", addonName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ManagedClusterAddOns: %w", err)
+	}
+
+	search := &ImageSearch{Matches: []ImageMatch{}, IncompleteClusters: []string{}}
+	for _, addon := range addons.Items {
+		// Checked again since not every client applies field selectors
+		if addon.Name != addonName {
+			continue
+		}
+		configMap, err := kubeClient.CoreV1().ConfigMaps(addon.Namespace).Get(ctx, basicagent.ImageReportConfigMapName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			klog.V(2).Infof("Cluster %s has no image report yet", addon.Namespace)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image report of cluster %s: %w", addon.Namespace, err)
+		}
+
+		report := basicagent.ImageReport{}
+		if err := json.Unmarshal([]byte(configMap.Data["report"]), &report); err != nil {
+			klog.Warningf("Ignoring invalid image report of cluster %s: %v", addon.Namespace, err)
+			continue
+		}
+		if report.Truncated {
+			search.IncompleteClusters = append(search.IncompleteClusters, addon.Namespace)
+		}
+		for _, image := range report.Images {
+			if imageMatches(image, query) {
+				search.Matches = append(search.Matches, ImageMatch{ClusterName: addon.Namespace, ImageInfo: image})
+			}
+		}
+	}
+
+	sort.Slice(search.Matches, func(i, j int) bool {
+		if search.Matches[i].ClusterName != search.Matches[j].ClusterName {
+			return search.Matches[i].ClusterName < search.Matches[j].ClusterName
+		}
+		return search.Matches[i].Image < search.Matches[j].Image
+	})
+	sort.Strings(search.IncompleteClusters)
+	return search, nil
+}
+
+// imageMatches returns whether the image matches the query of FindImage.
+func imageMatches(image basicagent.ImageInfo, query string) bool {
+	if i := strings.Index(query, "sha256:"); i >= 0 {
+		return image.Digest == query[i:]
+	}
+
+	repository, tag := splitImageTag(normalizeImage(query))
+	imageRepository, imageTag := splitImageTag(normalizeImage(image.Image))
+	return repository == imageRepository && (len(tag) == 0 || tag == imageTag)
+}
+
+// normalizeImage removes the default registry and namespace of Docker Hub images.
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	return strings.TrimPrefix(image, "library/")
+}
+
+// splitImageTag splits an image reference into its repository and tag.
+func splitImageTag(image string) (string, string) {
+	// A colon before the last slash is a registry port, not a tag
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
@@ -0,0 +1,73 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonfake "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+func TestFindImage(t *testing.T) {
+	const digest = "sha256:0123456789abcdef"
+	imageReport := func(t *testing.T, cluster string, truncated bool, images ...basicagent.ImageInfo) *corev1.ConfigMap {
+		report, err := json.Marshal(basicagent.ImageReport{ClusterName: cluster, Images: images, Truncated: truncated})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: basicagent.ImageReportConfigMapName, Namespace: cluster},
+			Data:       map[string]string{"report": string(report)},
+		}
+	}
+	addon := func(cluster string) *addonapiv1alpha1.ManagedClusterAddOn {
+		return &addonapiv1alpha1.ManagedClusterAddOn{ObjectMeta: metav1.ObjectMeta{Name: "basic-addon", Namespace: cluster}}
+	}
+
+	nginx := basicagent.ImageInfo{Image: "docker.io/library/nginx:1.27", Digest: digest, Workloads: []string{"Deployment/default/web"}}
+	nginxOther := basicagent.ImageInfo{Image: "nginx:1.26", Digest: "sha256:fedcba"}
+	registry := basicagent.ImageInfo{Image: "registry.local:5000/team/api:2", Digest: "sha256:aaaa"}
+
+	kubeClient := fake.NewSimpleClientset(
+		imageReport(t, "cluster1", false, nginx, registry),
+		imageReport(t, "cluster2", false, nginxOther),
+		imageReport(t, "cluster3", false, nginx),
+		imageReport(t, "cluster5", true, registry),
+	)
+	// cluster3 has a stale report, the addon is no longer enabled there
+	addonClient := addonfake.NewSimpleClientset(addon("cluster1"), addon("cluster2"), addon("cluster4"), addon("cluster5"))
+
+	tests := []struct {
+		query string
+		want  []ImageMatch
+	}{
+		{query: "nginx@" + digest, want: []ImageMatch{{ClusterName: "cluster1", ImageInfo: nginx}}},
+		{query: digest, want: []ImageMatch{{ClusterName: "cluster1", ImageInfo: nginx}}},
+		{query: "nginx", want: []ImageMatch{{ClusterName: "cluster1", ImageInfo: nginx}, {ClusterName: "cluster2", ImageInfo: nginxOther}}},
+		{query: "docker.io/nginx:1.26", want: []ImageMatch{{ClusterName: "cluster2", ImageInfo: nginxOther}}},
+		{query: "registry.local:5000/team/api", want: []ImageMatch{{ClusterName: "cluster1", ImageInfo: registry}, {ClusterName: "cluster5", ImageInfo: registry}}},
+		{query: "redis", want: []ImageMatch{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := FindImage(context.TODO(), kubeClient, addonClient, "basic-addon", tt.query)
+			if err != nil {
+				t.Fatalf("FindImage() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Matches, tt.want) {
+				t.Errorf("FindImage() = %+v, want %+v", got.Matches, tt.want)
+			}
+			// The image may run on cluster5 even when it isn't in its truncated report
+			if want := []string{"cluster5"}; !reflect.DeepEqual(got.IncompleteClusters, want) {
+				t.Errorf("IncompleteClusters = %v, want %v", got.IncompleteClusters, want)
+			}
+		})
+	}
+}
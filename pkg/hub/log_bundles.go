@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+// LogBundleResyncInterval is how often expired log bundles are deleted.
+const LogBundleResyncInterval = 10 * time.Minute
+
+// LogBundleReaper periodically deletes the log bundles uploaded by the agents
+// once their TTL expires. Agents can only create ConfigMaps on the hub, so
+// they can't delete them themselves.
+type LogBundleReaper struct {
+	kubeClient kubernetes.Interface
+	interval   time.Duration
+	now        func() time.Time
+}
+
+// NewLogBundleReaper returns a reaper of expired log bundles in all cluster namespaces.
+func NewLogBundleReaper(kubeClient kubernetes.Interface, interval time.Duration) *LogBundleReaper {
+	return &LogBundleReaper{
+		kubeClient: kubeClient,
+		interval:   interval,
+		now:        time.Now,
+	}
+}
+
+// Run deletes expired log bundles every interval until the context is done.
+func (r *LogBundleReaper) Run(ctx context.Context) {
+	klog.Infof("Starting log bundle reaper (interval %s)", r.interval)
+	wait.UntilWithContext(ctx, r.reap, r.interval)
+}
+
+// reap deletes the log bundles whose expiration time has passed.
+func (r *LogBundleReaper) reap(ctx context.Context) {
+	bundles, err := r.kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: basicagent.LogBundleLabel + "=true",
+	})
+	if err != nil {
+		klog.Errorf("Failed to list log bundles: %v", err)
+		return
+	}
+
+	for _, bundle := range bundles.Items {
+		expiresAt, err := strconv.ParseInt(bundle.Labels[basicagent.LogBundleExpiresAtLabel], 10, 64)
+		if err != nil {
+			klog.Warningf("Log bundle %s/%s has no valid expiration time, keeping it", bundle.Namespace, bundle.Name)
+			continue
+		}
+		if r.now().Before(time.Unix(expiresAt, 0)) {
+			continue
+		}
+		err = r.kubeClient.CoreV1().ConfigMaps(bundle.Namespace).Delete(ctx, bundle.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorf("Failed to delete expired log bundle %s/%s: %v", bundle.Namespace, bundle.Name, err)
+			continue
+		}
+		klog.Infof("Deleted expired log bundle %s/%s", bundle.Namespace, bundle.Name)
+	}
+}
@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
+)
+
+func TestLogBundleReaperDeletesExpiredBundles(t *testing.T) {
+	now := time.Now()
+	bundle := func(namespace, name, expiresAt string) *corev1.ConfigMap {
+		labels := map[string]string{basicagent.LogBundleLabel: "true"}
+		if len(expiresAt) > 0 {
+			labels[basicagent.LogBundleExpiresAtLabel] = expiresAt
+		}
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+
+	kubeclient := fake.NewSimpleClientset(
+		bundle("cluster1", "expired", strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)),
+		bundle("cluster2", "expired", strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)),
+		bundle("cluster1", "valid", strconv.FormatInt(now.Add(time.Hour).Unix(), 10)),
+		bundle("cluster1", "no-expiration", ""),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "pod-report", Namespace: "cluster1"}},
+	)
+	reaper := NewLogBundleReaper(kubeclient, LogBundleResyncInterval)
+	reaper.now = func() time.Time { return now }
+	reaper.reap(context.TODO())
+
+	tests := []struct {
+		namespace string
+		name      string
+		wantExist bool
+	}{
+		{namespace: "cluster1", name: "expired", wantExist: false},
+		{namespace: "cluster2", name: "expired", wantExist: false},
+		{namespace: "cluster1", name: "valid", wantExist: true},
+		{namespace: "cluster1", name: "no-expiration", wantExist: true},
+		{namespace: "cluster1", name: "pod-report", wantExist: true},
+	}
+	for _, tt := range tests {
+		_, err := kubeclient.CoreV1().ConfigMaps(tt.namespace).Get(context.TODO(), tt.name, metav1.GetOptions{})
+		if exists := err == nil; exists != tt.wantExist {
+			t.Errorf("%s/%s exists = %v, want %v", tt.namespace, tt.name, exists, tt.wantExist)
+		}
+	}
+}
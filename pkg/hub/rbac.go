@@ -4,19 +4,28 @@ import (
 	"context"
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
 )
 
 // AddonRBAC returns a PermissionConfigFunc that creates Role and RoleBinding
 // in the managed cluster namespace on the hub. This grants the agent permission
-// to write ConfigMaps (pod reports) to the hub.
+// to write its pod report, addon status and placement score to the hub, scoped
+// by resourceNames to the objects the agent owns.
+// Both objects are owned by the ManagedClusterAddOn, so they are garbage
+// collected when the addon is disabled for the cluster.
 func AddonRBAC(kubeConfig *rest.Config) agent.PermissionConfigFunc {
 	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
 		if kubeConfig == nil {
@@ -29,88 +38,217 @@ func AddonRBAC(kubeConfig *rest.Config) agent.PermissionConfigFunc {
 			return err
 		}
 
-		groups := agent.DefaultGroups(cluster.Name, addon.Name)
+		return ApplyAgentRBAC(context.TODO(), kubeclient, nil, cluster, addon)
+	}
+}
 
-		role := &rbacv1.Role{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      fmt.Sprintf("open-cluster-management:%s:agent", addon.Name),
-				Namespace: cluster.Name,
-			},
-			Rules: []rbacv1.PolicyRule{
-				// Strategy 1: Allow agent to read/write ConfigMaps for pod reports
-				{
-					Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
-					Resources: []string{"configmaps"},
-					APIGroups: []string{""},
-				},
-				// Strategy 2: Allow agent to read and update ManagedClusterAddOns status
-				{
-					Verbs:     []string{"get", "list", "watch", "update", "patch"},
-					Resources: []string{"managedclusteraddons", "managedclusteraddons/status"},
-					APIGroups: []string{"addon.open-cluster-management.io"},
-				},
-				// Strategy 3: Allow agent to create/update AddOnPlacementScores
-				{
-					Verbs:     []string{"get", "list", "watch", "create", "update", "patch"},
-					Resources: []string{"addonplacementscores", "addonplacementscores/status"},
-					APIGroups: []string{"cluster.open-cluster-management.io"},
-				},
-			},
+// agentRBACName returns the name shared by the agent Role and RoleBinding.
+func agentRBACName(addonName string) string {
+	return fmt.Sprintf("open-cluster-management:%s:agent", addonName)
+}
+
+// addonOwnerReference returns the owner reference pointing at the ManagedClusterAddOn.
+func addonOwnerReference(addon *addonapiv1alpha1.ManagedClusterAddOn) metav1.OwnerReference {
+	return *metav1.NewControllerRef(addon, addonapiv1alpha1.SchemeGroupVersion.WithKind("ManagedClusterAddOn"))
+}
+
+// mergeOwnerReference returns the owner references with ref added, or replacing
+// the owner with the same UID. Owners set by other controllers are kept.
+func mergeOwnerReference(refs []metav1.OwnerReference, ref metav1.OwnerReference) []metav1.OwnerReference {
+	merged := make([]metav1.OwnerReference, 0, len(refs)+1)
+	found := false
+	for _, existing := range refs {
+		if existing.UID != ref.UID {
+			merged = append(merged, existing)
+			continue
+		}
+		if !found {
+			merged = append(merged, ref)
+			found = true
 		}
+	}
+	if !found {
+		merged = append(merged, ref)
+	}
+	return merged
+}
 
-		binding := &rbacv1.RoleBinding{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      fmt.Sprintf("open-cluster-management:%s:agent", addon.Name),
-				Namespace: cluster.Name,
+// buildAgentRole returns the desired Role for the agent in the cluster namespace.
+func buildAgentRole(clusterName string, addon *addonapiv1alpha1.ManagedClusterAddOn) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            agentRBACName(addon.Name),
+			Namespace:       clusterName,
+			OwnerReferences: []metav1.OwnerReference{addonOwnerReference(addon)},
+		},
+		Rules: []rbacv1.PolicyRule{
+			// Strategy 1: Allow agent to read/write its report ConfigMaps (see ReportConfigMapNames)
+			{
+				Verbs:         []string{"get", "update", "patch", "delete"},
+				Resources:     []string{"configmaps"},
+				APIGroups:     []string{""},
+				ResourceNames: basicagent.ReportConfigMapNames(),
 			},
-			RoleRef: rbacv1.RoleRef{
-				APIGroup: "rbac.authorization.k8s.io",
-				Kind:     "Role",
-				Name:     fmt.Sprintf("open-cluster-management:%s:agent", addon.Name),
+			// Strategy 2: Allow agent to read and update its own ManagedClusterAddOn status
+			{
+				Verbs:         []string{"get", "update", "patch"},
+				Resources:     []string{"managedclusteraddons", "managedclusteraddons/status"},
+				APIGroups:     []string{"addon.open-cluster-management.io"},
+				ResourceNames: []string{addon.Name},
 			},
-			Subjects: []rbacv1.Subject{
-				{
-					Kind:     "Group",
-					APIGroup: "rbac.authorization.k8s.io",
-					Name:     groups[0],
-				},
+			// Strategy 3: Allow agent to update its own AddOnPlacementScore, and
+			// delete it when the addon is uninstalled
+			{
+				Verbs:         []string{"get", "update", "patch", "delete"},
+				Resources:     []string{"addonplacementscores", "addonplacementscores/status"},
+				APIGroups:     []string{"cluster.open-cluster-management.io"},
+				ResourceNames: []string{basicagent.PlacementScoreName},
 			},
-		}
+			// Commands: allow agent to read the commands of its cluster and
+			// report their result
+			{
+				Verbs:     []string{"get", "list", "watch"},
+				Resources: []string{"addoncommands"},
+				APIGroups: []string{"basic-addon.open-cluster-management.io"},
+			},
+			{
+				Verbs:     []string{"get", "update", "patch"},
+				Resources: []string{"addoncommands/status"},
+				APIGroups: []string{"basic-addon.open-cluster-management.io"},
+			},
+			// create can't be restricted by resourceNames, so it is granted in a
+			// separate create-only rule: the agent can add new objects but can't
+			// read, modify or delete any object other than the ones named above.
+			{
+				Verbs:     []string{"create"},
+				Resources: []string{"configmaps"},
+				APIGroups: []string{""},
+			},
+			{
+				Verbs:     []string{"create"},
+				Resources: []string{"addonplacementscores"},
+				APIGroups: []string{"cluster.open-cluster-management.io"},
+			},
+		},
+	}
+}
+
+// buildAgentRoleBinding returns the desired RoleBinding for the agent in the cluster namespace.
+// It is bound to the user of the current agent identity rather than to the
+// groups of the addon, so a rotated identity revokes the certificates issued
+// for the previous one.
+func buildAgentRoleBinding(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            agentRBACName(addon.Name),
+			Namespace:       cluster.Name,
+			OwnerReferences: []metav1.OwnerReference{addonOwnerReference(addon)},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     agentRBACName(addon.Name),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:     "User",
+				APIGroup: "rbac.authorization.k8s.io",
+				Name:     agent.DefaultUser(cluster.Name, addon.Name, AgentName(cluster)),
+			},
+		},
+	}
+}
 
-		// Create or update Role
-		_, err = kubeclient.RbacV1().Roles(cluster.Name).Get(context.TODO(), role.Name, metav1.GetOptions{})
-		switch {
-		case errors.IsNotFound(err):
-			_, createErr := kubeclient.RbacV1().Roles(cluster.Name).Create(context.TODO(), role, metav1.CreateOptions{})
-			if createErr != nil {
-				return createErr
-			}
-		case err != nil:
+// ApplyAgentRBAC creates the agent Role and RoleBinding in the cluster namespace,
+// or reverts them to the desired state when they were modified. Objects that
+// already match are left untouched, and owners other than the addon are kept.
+// When recorder is not nil, an event is emitted on the ManagedClusterAddOn for
+// every drift that was reverted.
+func ApplyAgentRBAC(ctx context.Context, kubeclient kubernetes.Interface, recorder record.EventRecorder,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	if err := applyRole(ctx, kubeclient, recorder, buildAgentRole(cluster.Name, addon), addon); err != nil {
+		return err
+	}
+	return applyRoleBinding(ctx, kubeclient, recorder, buildAgentRoleBinding(cluster, addon), addon)
+}
+
+func applyRole(ctx context.Context, kubeclient kubernetes.Interface, recorder record.EventRecorder,
+	role *rbacv1.Role, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	existing, err := kubeclient.RbacV1().Roles(role.Namespace).Get(ctx, role.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = kubeclient.RbacV1().Roles(role.Namespace).Create(ctx, role, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	ownerReferences := mergeOwnerReference(existing.OwnerReferences, addonOwnerReference(addon))
+	if equality.Semantic.DeepEqual(existing.Rules, role.Rules) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, ownerReferences) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Rules = role.Rules
+	updated.OwnerReferences = ownerReferences
+	if _, err = kubeclient.RbacV1().Roles(role.Namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	klog.Infof("Reverted drift on Role %s/%s", role.Namespace, role.Name)
+	recordDrift(recorder, addon, "Role", role.Namespace, role.Name)
+	return nil
+}
+
+func applyRoleBinding(ctx context.Context, kubeclient kubernetes.Interface, recorder record.EventRecorder,
+	binding *rbacv1.RoleBinding, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	existing, err := kubeclient.RbacV1().RoleBindings(binding.Namespace).Get(ctx, binding.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = kubeclient.RbacV1().RoleBindings(binding.Namespace).Create(ctx, binding, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	ownerReferences := mergeOwnerReference(existing.OwnerReferences, addonOwnerReference(addon))
+	if equality.Semantic.DeepEqual(existing.RoleRef, binding.RoleRef) &&
+		equality.Semantic.DeepEqual(existing.Subjects, binding.Subjects) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, ownerReferences) {
+		return nil
+	}
+
+	if !equality.Semantic.DeepEqual(existing.RoleRef, binding.RoleRef) {
+		// roleRef is immutable, so the binding has to be recreated
+		err = kubeclient.RbacV1().RoleBindings(binding.Namespace).Delete(ctx, binding.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
 			return err
-		default:
-			_, updateErr := kubeclient.RbacV1().Roles(cluster.Name).Update(context.TODO(), role, metav1.UpdateOptions{})
-			if updateErr != nil {
-				return updateErr
-			}
 		}
-
-		// Create or update RoleBinding
-		_, err = kubeclient.RbacV1().RoleBindings(cluster.Name).Get(context.TODO(), binding.Name, metav1.GetOptions{})
-		switch {
-		case errors.IsNotFound(err):
-			_, createErr := kubeclient.RbacV1().RoleBindings(cluster.Name).Create(context.TODO(), binding, metav1.CreateOptions{})
-			if createErr != nil {
-				return createErr
-			}
-		case err != nil:
+		recreated := binding.DeepCopy()
+		recreated.OwnerReferences = ownerReferences
+		if _, err = kubeclient.RbacV1().RoleBindings(binding.Namespace).Create(ctx, recreated, metav1.CreateOptions{}); err != nil {
 			return err
-		default:
-			_, updateErr := kubeclient.RbacV1().RoleBindings(cluster.Name).Update(context.TODO(), binding, metav1.UpdateOptions{})
-			if updateErr != nil {
-				return updateErr
-			}
 		}
+	} else {
+		updated := existing.DeepCopy()
+		updated.Subjects = binding.Subjects
+		updated.OwnerReferences = ownerReferences
+		if _, err = kubeclient.RbacV1().RoleBindings(binding.Namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
 
-		return nil
+	klog.Infof("Reverted drift on RoleBinding %s/%s", binding.Namespace, binding.Name)
+	recordDrift(recorder, addon, "RoleBinding", binding.Namespace, binding.Name)
+	return nil
+}
+
+// recordDrift emits an event on the ManagedClusterAddOn about a reverted RBAC object.
+func recordDrift(recorder record.EventRecorder, addon *addonapiv1alpha1.ManagedClusterAddOn, kind, namespace, name string) {
+	if recorder == nil {
+		return
 	}
+	recorder.Eventf(addon, corev1.EventTypeWarning, "AgentRBACDriftReverted",
+		"%s %s/%s was modified outside of the addon controller and has been reverted", kind, namespace, name)
 }
@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonscheme "open-cluster-management.io/api/client/addon/clientset/versioned/scheme"
+	clusterclient "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// RBACResyncInterval is how often the agent RBAC is checked for drift.
+const RBACResyncInterval = 5 * time.Minute
+
+// RBACReconciler periodically re-applies the agent Role and RoleBinding in every
+// cluster namespace where the addon is enabled, reverting manual edits.
+type RBACReconciler struct {
+	kubeClient    kubernetes.Interface
+	addonClient   addonclient.Interface
+	clusterClient clusterclient.Interface
+	recorder      record.EventRecorder
+	addonName     string
+	interval      time.Duration
+}
+
+// NewRBACReconciler returns a reconciler for the agent RBAC of the given addon.
+func NewRBACReconciler(kubeClient kubernetes.Interface, addonClient addonclient.Interface, clusterClient clusterclient.Interface,
+	recorder record.EventRecorder, addonName string, interval time.Duration) *RBACReconciler {
+	return &RBACReconciler{
+		kubeClient:    kubeClient,
+		addonClient:   addonClient,
+		clusterClient: clusterClient,
+		recorder:      recorder,
+		addonName:     addonName,
+		interval:      interval,
+	}
+}
+
+// NewEventRecorder returns an event recorder that writes events to the hub
+// and can reference addon API objects.
+func NewEventRecorder(kubeClient kubernetes.Interface, component string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(addonscheme.Scheme, corev1.EventSource{Component: component})
+}
+
+// Run reconciles the agent RBAC every interval until the context is done.
+func (r *RBACReconciler) Run(ctx context.Context) {
+	klog.Infof("Starting agent RBAC reconciler (interval %s)", r.interval)
+	wait.UntilWithContext(ctx, r.reconcile, r.interval)
+}
+
+// reconcile applies the agent RBAC for every ManagedClusterAddOn of this addon.
+func (r *RBACReconciler) reconcile(ctx context.Context) {
+	addons, err := r.addonClient.AddonV1alpha1().ManagedClusterAddOns(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", r.addonName).String(),
+	})
+	if err != nil {
+		klog.Errorf("Failed to list ManagedClusterAddOns: %v", err)
+		return
+	}
+	// The RoleBinding is bound to the agent identity of the cluster
+	clusterList, err := r.clusterClient.ClusterV1().ManagedClusters().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("Failed to list ManagedClusters: %v", err)
+		return
+	}
+	clusters := map[string]*clusterv1.ManagedCluster{}
+	for i := range clusterList.Items {
+		clusters[clusterList.Items[i].Name] = &clusterList.Items[i]
+	}
+
+	for i := range addons.Items {
+		addon := &addons.Items[i]
+		// Checked again since not every client applies field selectors
+		if addon.Name != r.addonName {
+			continue
+		}
+		// Owner references clean up RBAC of deleted addons, don't recreate it
+		if addon.DeletionTimestamp != nil {
+			continue
+		}
+		cluster, ok := clusters[addon.Namespace]
+		if !ok {
+			klog.V(2).Infof("ManagedCluster %s of addon %s not found, skipping its agent RBAC", addon.Namespace, addon.Name)
+			continue
+		}
+		if err := ApplyAgentRBAC(ctx, r.kubeClient, r.recorder, cluster, addon); err != nil {
+			klog.Errorf("Failed to reconcile agent RBAC in namespace %s: %v", addon.Namespace, err)
+		}
+	}
+}
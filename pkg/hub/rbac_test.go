@@ -1,11 +1,20 @@
 package hub
 
 import (
+	"context"
 	"testing"
 
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"open-cluster-management.io/addon-framework/pkg/agent"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	basicagent "github.com/totvs/addon-framework-basic/pkg/agent"
 )
 
 func TestAddonRBACWithNilConfig(t *testing.T) {
@@ -30,3 +39,303 @@ func TestAddonRBACWithNilConfig(t *testing.T) {
 		t.Errorf("AddonRBAC with nil config should return nil, got: %v", err)
 	}
 }
+
+func TestApplyAgentRBACCreatesOwnedObjects(t *testing.T) {
+	kubeclient := fake.NewSimpleClientset()
+	addon := newTestAddon()
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, nil, newTestCluster(), addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+
+	role, err := kubeclient.RbacV1().Roles("test-cluster").Get(context.TODO(), agentRBACName(addon.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected role to be created: %v", err)
+	}
+	assertOwnedByAddon(t, role.OwnerReferences, addon)
+
+	binding, err := kubeclient.RbacV1().RoleBindings("test-cluster").Get(context.TODO(), agentRBACName(addon.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected rolebinding to be created: %v", err)
+	}
+	assertOwnedByAddon(t, binding.OwnerReferences, addon)
+}
+
+func TestApplyAgentRBACNoDrift(t *testing.T) {
+	addon := newTestAddon()
+	kubeclient := fake.NewSimpleClientset(
+		buildAgentRole("test-cluster", addon),
+		buildAgentRoleBinding(newTestCluster(), addon),
+	)
+	recorder := record.NewFakeRecorder(10)
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, recorder, newTestCluster(), addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+
+	for _, action := range kubeclient.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("unexpected %s action on %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(recorder.Events))
+	}
+}
+
+func TestApplyAgentRBACRevertsDrift(t *testing.T) {
+	addon := newTestAddon()
+
+	role := buildAgentRole("test-cluster", addon)
+	role.Rules = append(role.Rules, rbacv1.PolicyRule{
+		Verbs:     []string{"*"},
+		Resources: []string{"secrets"},
+		APIGroups: []string{""},
+	})
+	binding := buildAgentRoleBinding(newTestCluster(), addon)
+	binding.RoleRef.Name = "cluster-admin"
+	binding.RoleRef.Kind = "ClusterRole"
+
+	kubeclient := fake.NewSimpleClientset(role, binding)
+	recorder := record.NewFakeRecorder(10)
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, recorder, newTestCluster(), addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+
+	gotRole, err := kubeclient.RbacV1().Roles("test-cluster").Get(context.TODO(), role.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get role: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(gotRole.Rules, buildAgentRole("test-cluster", addon).Rules) {
+		t.Errorf("role rules were not reverted: %v", gotRole.Rules)
+	}
+
+	gotBinding, err := kubeclient.RbacV1().RoleBindings("test-cluster").Get(context.TODO(), binding.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get rolebinding: %v", err)
+	}
+	if gotBinding.RoleRef.Kind != "Role" || gotBinding.RoleRef.Name != role.Name {
+		t.Errorf("rolebinding roleRef was not reverted: %v", gotBinding.RoleRef)
+	}
+
+	if len(recorder.Events) != 2 {
+		t.Errorf("expected 2 drift events, got %d", len(recorder.Events))
+	}
+}
+
+func TestApplyAgentRBACKeepsOtherOwners(t *testing.T) {
+	addon := newTestAddon()
+	otherOwner := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "backup", UID: types.UID("backup-uid")}
+
+	role := buildAgentRole("test-cluster", addon)
+	role.OwnerReferences = append(role.OwnerReferences, otherOwner)
+	binding := buildAgentRoleBinding(newTestCluster(), addon)
+	binding.OwnerReferences = []metav1.OwnerReference{otherOwner}
+	binding.Subjects = nil
+
+	kubeclient := fake.NewSimpleClientset(role, binding)
+	recorder := record.NewFakeRecorder(10)
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, recorder, newTestCluster(), addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+
+	gotRole, err := kubeclient.RbacV1().Roles("test-cluster").Get(context.TODO(), role.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get role: %v", err)
+	}
+	wantOwners := []metav1.OwnerReference{addonOwnerReference(addon), otherOwner}
+	if !equality.Semantic.DeepEqual(gotRole.OwnerReferences, wantOwners) {
+		t.Errorf("role owners = %+v, want %+v", gotRole.OwnerReferences, wantOwners)
+	}
+
+	gotBinding, err := kubeclient.RbacV1().RoleBindings("test-cluster").Get(context.TODO(), binding.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get rolebinding: %v", err)
+	}
+	wantOwners = []metav1.OwnerReference{otherOwner, addonOwnerReference(addon)}
+	if !equality.Semantic.DeepEqual(gotBinding.OwnerReferences, wantOwners) {
+		t.Errorf("rolebinding owners = %+v, want %+v", gotBinding.OwnerReferences, wantOwners)
+	}
+
+	// Only the rolebinding subjects drifted, the extra owner of the role isn't a drift
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected 1 drift event, got %d", len(recorder.Events))
+	}
+}
+
+func TestApplyAgentRBACBindsCurrentIdentity(t *testing.T) {
+	addon := newTestAddon()
+	cluster := newTestCluster()
+	kubeclient := fake.NewSimpleClientset()
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, nil, cluster, addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+	oldUser := agent.DefaultUser(cluster.Name, addon.Name, AgentName(cluster))
+	assertBoundTo(t, kubeclient, addon, oldUser)
+
+	// Rotating the identity moves the binding to the new user, revoking the old certificates
+	cluster.Annotations = map[string]string{AgentIdentityAnnotation: "rotated"}
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, nil, cluster, addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+	newUser := agent.DefaultUser(cluster.Name, addon.Name, AgentName(cluster))
+	if newUser == oldUser {
+		t.Fatalf("rotation didn't change the agent user %s", oldUser)
+	}
+	assertBoundTo(t, kubeclient, addon, newUser)
+}
+
+func assertBoundTo(t *testing.T, kubeclient *fake.Clientset, addon *addonapiv1alpha1.ManagedClusterAddOn, user string) {
+	t.Helper()
+	binding, err := kubeclient.RbacV1().RoleBindings("test-cluster").Get(context.TODO(), agentRBACName(addon.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get rolebinding: %v", err)
+	}
+	want := []rbacv1.Subject{{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: user}}
+	if !equality.Semantic.DeepEqual(binding.Subjects, want) {
+		t.Errorf("rolebinding subjects = %+v, want %+v", binding.Subjects, want)
+	}
+}
+
+func newTestCluster() *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+	}
+}
+
+func newTestAddon() *addonapiv1alpha1.ManagedClusterAddOn {
+	return &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basic-addon",
+			Namespace: "test-cluster",
+			UID:       types.UID("addon-uid"),
+		},
+	}
+}
+
+func assertOwnedByAddon(t *testing.T, refs []metav1.OwnerReference, addon *addonapiv1alpha1.ManagedClusterAddOn) {
+	t.Helper()
+	if len(refs) != 1 {
+		t.Fatalf("expected 1 owner reference, got %d", len(refs))
+	}
+	if refs[0].Kind != "ManagedClusterAddOn" || refs[0].Name != addon.Name || refs[0].UID != addon.UID {
+		t.Errorf("unexpected owner reference: %+v", refs[0])
+	}
+}
+
+func TestAgentRoleRulesAreNameScoped(t *testing.T) {
+	kubeclient := fake.NewSimpleClientset()
+	addon := newTestAddon()
+
+	if err := ApplyAgentRBAC(context.TODO(), kubeclient, nil, newTestCluster(), addon); err != nil {
+		t.Fatalf("ApplyAgentRBAC() error = %v", err)
+	}
+
+	role, err := kubeclient.RbacV1().Roles("test-cluster").Get(context.TODO(), agentRBACName(addon.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get role: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		apiGroup      string
+		resource      string
+		wantNames     []string
+		wantVerbs     []string
+		forbiddenVerb string
+	}{
+		{
+			name:          "report configmaps",
+			apiGroup:      "",
+			resource:      "configmaps",
+			wantNames:     basicagent.ReportConfigMapNames(),
+			wantVerbs:     []string{"get", "update"},
+			forbiddenVerb: "list",
+		},
+		{
+			name:          "own managedclusteraddon",
+			apiGroup:      "addon.open-cluster-management.io",
+			resource:      "managedclusteraddons/status",
+			wantNames:     []string{addon.Name},
+			wantVerbs:     []string{"get", "update"},
+			forbiddenVerb: "delete",
+		},
+		{
+			name:          "own placement score",
+			apiGroup:      "cluster.open-cluster-management.io",
+			resource:      "addonplacementscores",
+			wantNames:     []string{basicagent.PlacementScoreName},
+			wantVerbs:     []string{"get", "update", "delete"},
+			forbiddenVerb: "list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rule := range role.Rules {
+				if !contains(rule.APIGroups, tt.apiGroup) || !contains(rule.Resources, tt.resource) {
+					continue
+				}
+				if contains(rule.Verbs, tt.forbiddenVerb) {
+					t.Errorf("rule %v grants %s", rule, tt.forbiddenVerb)
+				}
+				if len(rule.ResourceNames) == 0 {
+					// Only create may be granted without resourceNames
+					if len(rule.Verbs) != 1 || rule.Verbs[0] != "create" {
+						t.Errorf("rule %v is not scoped by resourceNames", rule)
+					}
+					continue
+				}
+				if !equality.Semantic.DeepEqual(rule.ResourceNames, tt.wantNames) {
+					t.Errorf("resourceNames = %v, want %v", rule.ResourceNames, tt.wantNames)
+				}
+				for _, verb := range tt.wantVerbs {
+					if !contains(rule.Verbs, verb) {
+						t.Errorf("rule %v is missing verb %s", rule, verb)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAgentRoleAllowsCommands(t *testing.T) {
+	role := buildAgentRole("test-cluster", newTestAddon())
+
+	allowed := func(resource, verb string) bool {
+		for _, rule := range role.Rules {
+			if contains(rule.APIGroups, "basic-addon.open-cluster-management.io") &&
+				contains(rule.Resources, resource) && contains(rule.Verbs, verb) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, verb := range []string{"get", "list", "watch"} {
+		if !allowed("addoncommands", verb) {
+			t.Errorf("agent can't %s addoncommands", verb)
+		}
+	}
+	if !allowed("addoncommands/status", "update") {
+		t.Error("agent can't update addoncommands/status")
+	}
+	// Only hub operators create commands
+	for _, verb := range []string{"create", "update", "patch", "delete"} {
+		if allowed("addoncommands", verb) {
+			t.Errorf("agent can %s addoncommands", verb)
+		}
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}